@@ -0,0 +1,293 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	ErrUnsupportedType = errors.New("unsupported question type")
+
+	// types maps xlsform question types to the JSON type and format of their submitted value
+	types = map[string][2]string{
+		"text":             {"string", ""},
+		"barcode":          {"string", ""},
+		"calculate":        {"string", ""},
+		"hidden":           {"string", ""},
+		"acknowledge":      {"string", ""},
+		"integer":          {"integer", ""},
+		"decimal":          {"number", ""},
+		"range":            {"number", ""},
+		"date":             {"string", "date"},
+		"today":            {"string", "date"},
+		"time":             {"string", "time"},
+		"dateTime":         {"string", "date-time"},
+		"start":            {"string", "date-time"},
+		"end":              {"string", "date-time"},
+		"geopoint":         {"string", ""},
+		"geotrace":         {"string", ""},
+		"geoshape":         {"string", ""},
+		"image":            {"string", ""},
+		"audio":            {"string", ""},
+		"background-audio": {"string", ""},
+		"video":            {"string", ""},
+		"file":             {"string", ""},
+		"deviceid":         {"string", ""},
+		"username":         {"string", ""},
+		"phonenumber":      {"string", ""},
+		"email":            {"string", "email"},
+		"audit":            {"string", ""},
+	}
+)
+
+// schema is the subset of a JSON Schema we generate
+type schema struct {
+	Schema      string      `json:"$schema,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Format      string      `json:"format,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Items       *schema     `json:"items,omitempty"`
+	UniqueItems bool        `json:"uniqueItems,omitempty"`
+	Properties  *properties `json:"properties,omitempty"`
+	Required    []string    `json:"required,omitempty"`
+}
+
+// properties keeps the fields of an object in the order they are asked in the form
+type properties struct {
+	names   []string
+	schemas map[string]*schema
+}
+
+func (p *properties) add(name string, s *schema) {
+	if p.schemas == nil {
+		p.schemas = map[string]*schema{}
+	}
+	if _, ok := p.schemas[name]; !ok {
+		p.names = append(p.names, name)
+	}
+	p.schemas[name] = s
+}
+
+func (p *properties) MarshalJSON() ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteString("{")
+	for i, name := range p.names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		val, err := marshal(p.schemas[name])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+type Encoder struct{}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Encode returns a JSON Schema for the submissions of the CUE form at filePath
+func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+	source, err := xlsform.ParseCueForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeForm(source)
+}
+
+// EncodeForm returns a JSON Schema for the submissions of form. Groups become nested objects,
+// repeats arrays of objects and select questions enums of their choice names
+func (encoder *Encoder) EncodeForm(form *xlsform.CueForm) (*bytes.Buffer, error) {
+	s := &encodeState{}
+	root := &schema{Schema: draft, Type: "object", Properties: &properties{}}
+	if form.Settings != nil {
+		if v := form.Settings.LookupPath(cue.ParsePath("form_title")); v.Exists() {
+			root.Title, _ = v.String()
+		}
+		if v := form.Settings.LookupPath(cue.ParsePath("default_language")); v.Exists() {
+			s.defaultLang, _ = v.String()
+		}
+	}
+	values := []cue.Value{}
+	for _, val := range form.SurveyElements {
+		values = append(values, *val)
+	}
+	if err := s.addProperties(root, values); err != nil {
+		return nil, err
+	}
+	meta := &schema{Type: "object", Properties: &properties{}}
+	meta.Properties.add("instanceID", &schema{Type: "string"})
+	root.Properties.add("meta", meta)
+	b, err := marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, b, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out, nil
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	b := &bytes.Buffer{}
+	e := json.NewEncoder(b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+type encodeState struct {
+	defaultLang string
+}
+
+// addProperties adds the survey elements in values to the object schema obj
+func (s *encodeState) addProperties(obj *schema, values []cue.Value) error {
+	for _, val := range values {
+		name, err := val.LookupPath(cue.ParsePath("name")).String()
+		if err != nil {
+			return err
+		}
+		prop, err := s.elementSchema(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if prop == nil {
+			continue
+		}
+		obj.Properties.add(name, prop)
+		if required, _ := xlsform.ValueString(val.LookupPath(cue.ParsePath("required"))); required == "yes" || required == "true()" {
+			obj.Required = append(obj.Required, name)
+		}
+	}
+	return nil
+}
+
+// elementSchema returns the schema of a survey element's submitted value, nil for elements like
+// notes that don't submit anything
+func (s *encodeState) elementSchema(val cue.Value) (*schema, error) {
+	kind, err := val.LookupPath(cue.ParsePath("type")).String()
+	if err != nil {
+		return nil, err
+	}
+	kind = strings.ReplaceAll(kind, " ", "_")
+	prop := &schema{}
+	if prop.Title, err = s.text(val, "label"); err != nil {
+		return nil, err
+	}
+	if prop.Description, err = s.text(val, "hint"); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "note":
+		return nil, nil
+	case "begin_group", "begin_repeat":
+		obj := &schema{Type: "object", Properties: &properties{}}
+		children := val.LookupPath(cue.ParsePath("children"))
+		if children.Exists() {
+			iter, err := children.List()
+			if err != nil {
+				return nil, err
+			}
+			list := []cue.Value{}
+			for iter.Next() {
+				list = append(list, iter.Value())
+			}
+			if err := s.addProperties(obj, list); err != nil {
+				return nil, err
+			}
+		}
+		if kind == "begin_group" {
+			obj.Title, obj.Description = prop.Title, prop.Description
+			return obj, nil
+		}
+		prop.Type, prop.Items = "array", obj
+	case "select_one", "select_multiple", "rank":
+		names, err := choiceNames(val.LookupPath(cue.ParsePath("choices")))
+		if err != nil {
+			return nil, err
+		}
+		if kind == "select_one" {
+			prop.Type, prop.Enum = "string", names
+		} else {
+			prop.Type, prop.Items, prop.UniqueItems = "array", &schema{Type: "string", Enum: names}, true
+		}
+	case "select_one_from_file", "select_one_external":
+		// the choices live outside the form so any name goes
+		prop.Type = "string"
+	case "select_multiple_from_file":
+		prop.Type, prop.Items, prop.UniqueItems = "array", &schema{Type: "string"}, true
+	default:
+		t, ok := types[kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", kind, ErrUnsupportedType)
+		}
+		prop.Type, prop.Format = t[0], t[1]
+	}
+	return prop, nil
+}
+
+// text returns a translatable column in the form's default language or the first one we find
+func (s *encodeState) text(val cue.Value, column string) (string, error) {
+	texts := val.LookupPath(cue.ParsePath(column))
+	if !texts.Exists() {
+		return "", nil
+	}
+	if s.defaultLang != "" {
+		if v := texts.LookupPath(cue.MakePath(cue.Str(s.defaultLang))); v.Exists() {
+			return v.String()
+		}
+	}
+	langs, err := texts.Fields()
+	if err != nil {
+		return "", err
+	}
+	if langs.Next() {
+		return langs.Value().String()
+	}
+	return "", nil
+}
+
+func choiceNames(val cue.Value) ([]string, error) {
+	iter, err := val.LookupPath(cue.ParsePath("choices")).List()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for iter.Next() {
+		fields, err := iter.Value().Fields()
+		if err != nil {
+			return nil, err
+		}
+		for fields.Next() {
+			if fields.Label() != "filterCategory" && fields.Label() != "media" {
+				names = append(names, fields.Label())
+			}
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,41 @@
+package jsonschema
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "testdata/form.cue",
+			want: "testdata/form.json",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			b, err := NewEncoder().Encode(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := b.String(); have != string(want) {
+				t.Fatalf("have\n%s\nwant\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestEncodeUnsupportedType(t *testing.T) {
+	_, err := NewEncoder().Encode("testdata/unsupported.cue")
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("have %v, want %v", err, ErrUnsupportedType)
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+#Question: {...}
+
+color: #Question & {
+	type: "colour"
+	name: "color"
+	label: "English (en)": "Favourite colour"
+}
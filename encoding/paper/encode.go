@@ -0,0 +1,325 @@
+package paper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+type Format int
+
+const (
+	HTML Format = iota
+	Markdown
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown paper form format")
+
+	refRe      = regexp.MustCompile(`\$\{([^}]+)\}`)
+	selectedRe = regexp.MustCompile(`selected\(\s*(\$\{[^}]+\})\s*,\s*'([^']*)'\s*\)`)
+	// exprWords rewrites xpath operators and functions into words an enumerator can read
+	exprWords = strings.NewReplacer(
+		"!=", "≠", ">=", "≥", "<=", "≤",
+		" div ", " ÷ ", " mod ", " remainder ",
+		"true()", "yes", "false()", "no", "today()", "today",
+		"string-length(.)", "length of the answer",
+	)
+	// hiddenTypes are survey elements that are never shown to the respondent
+	hiddenTypes = map[string]struct{}{
+		"calculate": {}, "hidden": {}, "start": {}, "end": {}, "today": {}, "deviceid": {},
+		"username": {}, "phonenumber": {}, "email": {}, "audit": {}, "background-audio": {},
+	}
+)
+
+// item is a survey element laid out for print
+type item struct {
+	kind       string
+	name       string
+	number     int
+	label      string
+	hint       string
+	required   bool
+	notes      []string
+	choices    []string
+	selectMany bool
+	children   []*item
+}
+
+func (it *item) isGroup() bool {
+	return it.kind == "begin_group" || it.kind == "begin_repeat"
+}
+
+type Encoder struct {
+	format Format
+	lang   string
+}
+
+// NewEncoder returns an encoder that renders forms in format
+func NewEncoder(format Format) *Encoder {
+	return &Encoder{format: format}
+}
+
+// UseLang changes the language we pick labels in, the form's default language is used otherwise
+func (encoder *Encoder) UseLang(lang string) {
+	encoder.lang = lang
+}
+
+// Encode returns a printable version of the CUE file at filePath
+func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+	source, err := xlsform.ParseCueForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeForm(source)
+}
+
+// EncodeForm returns a printable version of form, groups become sections and questions are
+// numbered in the order they are asked
+func (encoder *Encoder) EncodeForm(form *xlsform.CueForm) (*bytes.Buffer, error) {
+	s := &layoutState{lang: encoder.lang, numbers: map[string]int{}}
+	title := ""
+	if form.Settings != nil {
+		if v := form.Settings.LookupPath(cue.ParsePath("form_title")); v.Exists() {
+			title, _ = v.String()
+		}
+		if v := form.Settings.LookupPath(cue.ParsePath("default_language")); v.Exists() {
+			s.defaultLang, _ = v.String()
+		}
+	}
+	if s.lang == "" {
+		s.lang = s.defaultLang
+	}
+	values := []cue.Value{}
+	for _, val := range form.SurveyElements {
+		values = append(values, *val)
+	}
+	if err := s.number(values); err != nil {
+		return nil, err
+	}
+	items, err := s.items(values)
+	if err != nil {
+		return nil, err
+	}
+	b := &bytes.Buffer{}
+	switch encoder.format {
+	case HTML:
+		writeHTML(b, title, items)
+	case Markdown:
+		writeMarkdown(b, title, items)
+	default:
+		return nil, fmt.Errorf("%d: %w", encoder.format, ErrUnknownFormat)
+	}
+	return b, nil
+}
+
+type layoutState struct {
+	lang        string
+	defaultLang string
+	next        int
+	numbers     map[string]int
+}
+
+// number assigns question numbers up front so that notes can refer to questions asked later
+func (s *layoutState) number(values []cue.Value) error {
+	for _, val := range values {
+		kind, err := lookupString(val, "type")
+		if err != nil {
+			return err
+		}
+		kind = strings.ReplaceAll(kind, " ", "_")
+		name, _ := lookupString(val, "name")
+		if children := val.LookupPath(cue.ParsePath("children")); children.Exists() {
+			list, err := listValues(children)
+			if err != nil {
+				return err
+			}
+			if err := s.number(list); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, hidden := hiddenTypes[kind]; hidden || kind == "note" {
+			continue
+		}
+		s.next++
+		s.numbers[name] = s.next
+	}
+	return nil
+}
+
+func (s *layoutState) items(values []cue.Value) ([]*item, error) {
+	items := []*item{}
+	for _, val := range values {
+		it, err := s.item(val)
+		if err != nil {
+			return nil, err
+		}
+		if it != nil {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+func (s *layoutState) item(val cue.Value) (*item, error) {
+	kind, err := lookupString(val, "type")
+	if err != nil {
+		return nil, err
+	}
+	it := &item{kind: strings.ReplaceAll(kind, " ", "_")}
+	if _, hidden := hiddenTypes[it.kind]; hidden {
+		return nil, nil
+	}
+	it.name, _ = lookupString(val, "name")
+	it.number = s.numbers[it.name]
+	if it.label, err = s.text(val, "label"); err != nil {
+		return nil, err
+	}
+	if it.hint, err = s.text(val, "hint"); err != nil {
+		return nil, err
+	}
+	if it.label == "" {
+		it.label = it.name
+	}
+	if required, _ := lookupString(val, "required"); required == "yes" || required == "true()" {
+		it.required = true
+	}
+	if relevant, _ := lookupString(val, "relevant"); relevant != "" {
+		it.notes = append(it.notes, fmt.Sprintf("Ask only if %s", s.readable(relevant)))
+	}
+	if constraint, _ := lookupString(val, "constraint"); constraint != "" {
+		note := fmt.Sprintf("Valid if %s", s.readable(constraint))
+		if msg, err := s.text(val, "constraint_message"); err != nil {
+			return nil, err
+		} else if msg != "" {
+			note = fmt.Sprintf("%s (%s)", note, msg)
+		}
+		it.notes = append(it.notes, note)
+	}
+	if count, _ := lookupString(val, "repeat_count"); count != "" {
+		it.notes = append(it.notes, fmt.Sprintf("Repeat %s times", s.readable(count)))
+	} else if it.kind == "begin_repeat" {
+		it.notes = append(it.notes, "Repeat as many times as needed")
+	}
+	if choices := val.LookupPath(cue.ParsePath("choices")); choices.Exists() {
+		it.selectMany = strings.HasPrefix(it.kind, "select_multiple")
+		if it.choices, err = s.choiceLabels(choices); err != nil {
+			return nil, err
+		}
+	}
+	if children := val.LookupPath(cue.ParsePath("children")); children.Exists() {
+		list, err := listValues(children)
+		if err != nil {
+			return nil, err
+		}
+		if it.children, err = s.items(list); err != nil {
+			return nil, err
+		}
+	}
+	return it, nil
+}
+
+// text returns the translatable column in the chosen language falling back to the default one
+func (s *layoutState) text(val cue.Value, column string) (string, error) {
+	texts := val.LookupPath(cue.ParsePath(column))
+	if !texts.Exists() {
+		return "", nil
+	}
+	return s.translate(texts)
+}
+
+func (s *layoutState) translate(texts cue.Value) (string, error) {
+	for _, lang := range []string{s.lang, s.defaultLang} {
+		if lang == "" {
+			continue
+		}
+		if v := texts.LookupPath(cue.MakePath(cue.Str(lang))); v.Exists() {
+			return v.String()
+		}
+	}
+	langs, err := texts.Fields()
+	if err != nil {
+		return "", err
+	}
+	if langs.Next() {
+		return langs.Value().String()
+	}
+	return "", nil
+}
+
+func (s *layoutState) choiceLabels(val cue.Value) ([]string, error) {
+	list, err := listValues(val.LookupPath(cue.ParsePath("choices")))
+	if err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for _, choice := range list {
+		fields, err := choice.Fields()
+		if err != nil {
+			return nil, err
+		}
+		for fields.Next() {
+			if fields.Label() == "filterCategory" || fields.Label() == "media" {
+				continue
+			}
+			label, err := s.translate(fields.Value())
+			if err != nil {
+				return nil, err
+			}
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
+
+// readable rewrites an xlsform expression so it can be read off paper, references become
+// question numbers and xpath operators become words or symbols
+func (s *layoutState) readable(expr string) string {
+	expr = selectedRe.ReplaceAllString(expr, "$1 is '$2'")
+	expr = refRe.ReplaceAllStringFunc(expr, func(ref string) string {
+		name := refRe.FindStringSubmatch(ref)[1]
+		if number, ok := s.numbers[name]; ok {
+			return fmt.Sprintf("Q%d", number)
+		}
+		return name
+	})
+	if strings.HasPrefix(strings.TrimSpace(expr), ". ") {
+		expr = "answer " + strings.TrimPrefix(strings.TrimSpace(expr), ". ")
+	}
+	return exprWords.Replace(expr)
+}
+
+func lookupString(val cue.Value, path string) (string, error) {
+	v := val.LookupPath(cue.ParsePath(path))
+	switch v.Kind() {
+	case cue.BoolKind:
+		b, err := v.Bool()
+		if b {
+			return "yes", err
+		}
+		return "no", err
+	case cue.IntKind:
+		i, err := v.Int64()
+		return strconv.FormatInt(i, 10), err
+	}
+	return v.String()
+}
+
+func listValues(val cue.Value) ([]cue.Value, error) {
+	iter, err := val.List()
+	if err != nil {
+		return nil, err
+	}
+	values := []cue.Value{}
+	for iter.Next() {
+		values = append(values, iter.Value())
+	}
+	return values, nil
+}
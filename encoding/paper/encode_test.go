@@ -0,0 +1,52 @@
+package paper
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		file   string
+		format Format
+		lang   string
+		want   string
+	}{
+		{
+			file:   "testdata/form.cue",
+			format: Markdown,
+			want:   "testdata/form.md",
+		},
+		{
+			file:   "testdata/form.cue",
+			format: HTML,
+			lang:   "Afrikaans (af)",
+			want:   "testdata/form_af.html",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			encoder := NewEncoder(tc.format)
+			encoder.UseLang(tc.lang)
+			b, err := encoder.Encode(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := b.String(); have != string(want) {
+				t.Fatalf("have\n%s\nwant\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestEncodeUnknownFormat(t *testing.T) {
+	_, err := NewEncoder(Format(-1)).Encode("testdata/form.cue")
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("have %v, want %v", err, ErrUnknownFormat)
+	}
+}
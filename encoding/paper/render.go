@@ -0,0 +1,176 @@
+package paper
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	checkbox = "☐"
+	// answerLine is the blank left for free text answers
+	answerLine = "________________________________________"
+
+	htmlStyle = `body { font-family: sans-serif; max-width: 48em; margin: 2em auto; }
+section { border-left: 3px solid #999; padding-left: 1em; margin: 1.5em 0; }
+.question { margin: 1.2em 0; page-break-inside: avoid; }
+.label { font-weight: bold; margin-bottom: 0.2em; }
+.hint { font-style: italic; margin: 0.2em 0; }
+.note { font-size: 0.9em; color: #555; margin: 0.2em 0; }
+.answer { border-bottom: 1px solid #000; height: 1.6em; }
+.choices { list-style: none; padding-left: 0.5em; }
+.required { color: #b00; }`
+)
+
+// answerSpace returns the blank an enumerator fills in for a question of kind
+func answerSpace(kind string) string {
+	switch kind {
+	case "integer", "decimal":
+		return "Number: ____________"
+	case "date":
+		return "Date: __ / __ / ____"
+	case "time":
+		return "Time: __ : __"
+	case "dateTime":
+		return "Date: __ / __ / ____  Time: __ : __"
+	case "geopoint":
+		return "Latitude: ____________  Longitude: ____________"
+	case "geotrace", "geoshape":
+		return "Points (latitude, longitude): ________________________________"
+	case "image", "audio", "video", "file":
+		return fmt.Sprintf("Attach %s", kind)
+	case "barcode":
+		return "Code: ____________"
+	case "acknowledge":
+		return checkbox + " OK"
+	case "note":
+		return ""
+	default:
+		return answerLine
+	}
+}
+
+// headingLevel caps the heading of nested groups at the deepest level html and markdown have
+func headingLevel(depth int) int {
+	if depth > 6 {
+		return 6
+	}
+	return depth
+}
+
+func choiceHint(it *item) string {
+	switch {
+	case it.kind == "rank":
+		return "Rank the options"
+	case it.selectMany:
+		return "Select all that apply"
+	default:
+		return "Select one"
+	}
+}
+
+func writeMarkdown(b *bytes.Buffer, title string, items []*item) {
+	if title != "" {
+		fmt.Fprintf(b, "# %s\n\n", title)
+	}
+	writeMarkdownItems(b, items, 2)
+}
+
+func writeMarkdownItems(b *bytes.Buffer, items []*item, depth int) {
+	for _, it := range items {
+		if it.isGroup() {
+			fmt.Fprintf(b, "%s %s\n\n", strings.Repeat("#", headingLevel(depth)), it.label)
+			writeMarkdownNotes(b, it)
+			writeMarkdownItems(b, it.children, depth+1)
+			continue
+		}
+		if it.kind == "note" {
+			fmt.Fprintf(b, "*%s*\n\n", it.label)
+			writeMarkdownNotes(b, it)
+			continue
+		}
+		fmt.Fprintf(b, "**%d. %s**", it.number, it.label)
+		if it.required {
+			b.WriteString(" \\*")
+		}
+		b.WriteString("\n\n")
+		if it.hint != "" {
+			fmt.Fprintf(b, "*%s*\n\n", it.hint)
+		}
+		writeMarkdownNotes(b, it)
+		if it.choices != nil {
+			fmt.Fprintf(b, "%s:\n\n", choiceHint(it))
+			for _, choice := range it.choices {
+				fmt.Fprintf(b, "- [ ] %s\n", choice)
+			}
+			b.WriteString("\n")
+		} else if space := answerSpace(it.kind); space != "" {
+			fmt.Fprintf(b, "%s\n\n", space)
+		}
+	}
+}
+
+func writeMarkdownNotes(b *bytes.Buffer, it *item) {
+	for _, note := range it.notes {
+		fmt.Fprintf(b, "> %s\n", note)
+	}
+	if len(it.notes) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+func writeHTML(b *bytes.Buffer, title string, items []*item) {
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(b, "<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", html.EscapeString(title), htmlStyle)
+	if title != "" {
+		fmt.Fprintf(b, "<h1>%s</h1>\n", html.EscapeString(title))
+	}
+	writeHTMLItems(b, items, 2)
+	b.WriteString("</body>\n</html>\n")
+}
+
+func writeHTMLItems(b *bytes.Buffer, items []*item, depth int) {
+	for _, it := range items {
+		if it.isGroup() {
+			heading := headingLevel(depth)
+			fmt.Fprintf(b, "<section class=\"%s\">\n<h%d>%s</h%d>\n", strings.TrimPrefix(it.kind, "begin_"), heading, html.EscapeString(it.label), heading)
+			writeHTMLNotes(b, it)
+			writeHTMLItems(b, it.children, depth+1)
+			b.WriteString("</section>\n")
+			continue
+		}
+		b.WriteString("<div class=\"question\">\n")
+		if it.kind == "note" {
+			fmt.Fprintf(b, "<p class=\"hint\">%s</p>\n", html.EscapeString(it.label))
+		} else {
+			fmt.Fprintf(b, "<p class=\"label\">%d. %s", it.number, html.EscapeString(it.label))
+			if it.required {
+				b.WriteString(" <span class=\"required\">*</span>")
+			}
+			b.WriteString("</p>\n")
+		}
+		if it.hint != "" {
+			fmt.Fprintf(b, "<p class=\"hint\">%s</p>\n", html.EscapeString(it.hint))
+		}
+		writeHTMLNotes(b, it)
+		if it.choices != nil {
+			fmt.Fprintf(b, "<p class=\"note\">%s</p>\n<ul class=\"choices\">\n", choiceHint(it))
+			for _, choice := range it.choices {
+				fmt.Fprintf(b, "<li>%s %s</li>\n", checkbox, html.EscapeString(choice))
+			}
+			b.WriteString("</ul>\n")
+		} else if space := answerSpace(it.kind); space == answerLine {
+			b.WriteString("<div class=\"answer\"></div>\n")
+		} else if space != "" {
+			fmt.Fprintf(b, "<p>%s</p>\n", html.EscapeString(space))
+		}
+		b.WriteString("</div>\n")
+	}
+}
+
+func writeHTMLNotes(b *bytes.Buffer, it *item) {
+	for _, note := range it.notes {
+		fmt.Fprintf(b, "<p class=\"note\">%s</p>\n", html.EscapeString(note))
+	}
+}
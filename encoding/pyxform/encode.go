@@ -0,0 +1,327 @@
+package pyxform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+var (
+	// types maps xlsform question types to the names pyxform uses for them internally
+	types = map[string]string{
+		"select_one":                "select one",
+		"select_multiple":           "select all that apply",
+		"select_one_from_file":      "select one",
+		"select_multiple_from_file": "select all that apply",
+		"select_one_external":       "select one external",
+		"begin_group":               "group",
+		"begin_repeat":              "repeat",
+	}
+	// bindColumns are the columns pyxform keeps under an element's bind, mapped to their bind attribute
+	bindColumns = map[string]string{
+		"relevant":           "relevant",
+		"constraint":         "constraint",
+		"constraint_message": "jr:constraintMsg",
+		"required":           "required",
+		"required_message":   "jr:requiredMsg",
+		"calculation":        "calculate",
+		"read_only":          "readonly",
+		"save_to":            "entities:saveto",
+	}
+	// controlColumns are the columns pyxform keeps under an element's control
+	controlColumns = map[string]string{
+		"appearance":   "appearance",
+		"repeat_count": "jr:count",
+	}
+)
+
+type Encoder struct{}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Encode returns the pyxform JSON representation of the CUE file at filePath
+func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+	source, err := xlsform.ParseCueForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeForm(source)
+}
+
+// EncodeForm returns the pyxform JSON representation of form. Groups and repeats keep their
+// children nested, select questions reference their list in the survey level choices. The
+// elements that can't be written are all reported in an xlsform.EncodeErrors
+func (encoder *Encoder) EncodeForm(form *xlsform.CueForm) (*bytes.Buffer, error) {
+	survey := map[string]interface{}{"name": "data", "type": "survey"}
+	if form.Settings != nil {
+		settings, err := elementToMap(*form.Settings, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, val := range settings {
+			switch key {
+			case "type":
+			case "form_title":
+				survey["title"] = val
+			case "form_id":
+				survey["id_string"] = val
+				survey["sms_keyword"] = val
+			default:
+				survey[key] = val
+			}
+		}
+	}
+	choices := map[string]interface{}{}
+	children := []interface{}{}
+	errs := xlsform.EncodeErrors{}
+	for _, val := range form.SurveyElements {
+		child, err := surveyElementToMap(*val, choices)
+		if err != nil {
+			addError(&errs, *val, err)
+			continue
+		}
+		children = append(children, child)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	children = append(children, map[string]interface{}{
+		"name":    "meta",
+		"type":    "group",
+		"control": map[string]interface{}{"bodyless": true},
+		"children": []interface{}{
+			map[string]interface{}{
+				"name": "instanceID",
+				"type": "calculate",
+				"bind": map[string]interface{}{"readonly": "true()", "jr:preload": "uid"},
+			},
+		},
+	})
+	survey["children"] = children
+	if len(choices) > 0 {
+		survey["choices"] = choices
+	}
+	b := &bytes.Buffer{}
+	e := json.NewEncoder(b)
+	e.SetIndent("", "  ")
+	e.SetEscapeHTML(false)
+	if err := e.Encode(survey); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// surveyElementToMap is elementToMap for the elements of the survey, they can't be written
+// without a type and name and select questions can't be written without their choices
+func surveyElementToMap(val cue.Value, choices map[string]interface{}) (map[string]interface{}, error) {
+	errs := xlsform.EncodeErrors{}
+	for _, field := range []string{"type", "name"} {
+		if !val.LookupPath(cue.ParsePath(field)).Exists() {
+			addError(&errs, val, fmt.Errorf("%s: %w", field, xlsform.ErrMissingField))
+		}
+	}
+	qtype, _ := val.LookupPath(cue.ParsePath("type")).String()
+	if strings.HasPrefix(strings.ReplaceAll(qtype, " ", "_"), "select_") && !val.LookupPath(cue.ParsePath("choices")).Exists() {
+		addError(&errs, val, fmt.Errorf("choices: %w", xlsform.ErrMissingField))
+	}
+	element, err := elementToMap(val, choices)
+	addError(&errs, val, err)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return element, nil
+}
+
+// addError records the problem err with val, the problems already collected from its children
+// are kept as they are
+func addError(errs *xlsform.EncodeErrors, val cue.Value, err error) {
+	var encodeErrs xlsform.EncodeErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &encodeErrs):
+		*errs = append(*errs, encodeErrs...)
+	default:
+		*errs = append(*errs, &xlsform.EncodeError{Path: val.Path().String(), Pos: val.Pos(), Err: err})
+	}
+}
+
+// elementToMap converts a survey element to its pyxform JSON object, choice lists are added to choices
+func elementToMap(val cue.Value, choices map[string]interface{}) (map[string]interface{}, error) {
+	element := map[string]interface{}{}
+	bind := map[string]interface{}{}
+	control := map[string]interface{}{}
+	fromFile := false
+	fields, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	for fields.Next() {
+		key := fields.Label()
+		var value interface{}
+		switch {
+		case key == "children":
+			children := []interface{}{}
+			iter, err := fields.Value().List()
+			if err != nil {
+				return nil, err
+			}
+			errs := xlsform.EncodeErrors{}
+			for iter.Next() {
+				child, err := surveyElementToMap(iter.Value(), choices)
+				if err != nil {
+					addError(&errs, iter.Value(), err)
+					continue
+				}
+				children = append(children, child)
+			}
+			if len(errs) > 0 {
+				return nil, errs
+			}
+			element["children"] = children
+			continue
+		case key == "choices":
+			listName, list, err := choiceList(fields.Value())
+			if err != nil {
+				return nil, err
+			}
+			fromFile, _ = fields.Value().LookupPath(cue.ParsePath("from_file")).Bool()
+			choices[listName] = list
+			element["choices"] = list
+			element["list_name"] = listName
+			element["itemset"] = listName
+			continue
+		case key == "media":
+			value, err = media(fields.Value())
+		case xlsform.IsTranslatableColumn(key):
+			value, err = translatable(fields.Value())
+		default:
+			value, err = xlsform.ValueString(fields.Value())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if attr, ok := bindColumns[key]; ok {
+			bind[attr] = value
+		} else if attr, ok := controlColumns[key]; ok {
+			control[attr] = value
+		} else {
+			element[key] = value
+		}
+	}
+	if qtype, ok := element["type"].(string); ok {
+		qtype = strings.ReplaceAll(qtype, " ", "_")
+		if listName, ok := element["list_name"].(string); ok && (strings.HasSuffix(qtype, "_from_file") || fromFile) {
+			// the choices of these live in a csv attachment named after the list
+			element["itemset"] = fmt.Sprintf("%s.csv", listName)
+			delete(choices, listName)
+			delete(element, "choices")
+		}
+		if t, ok := types[qtype]; ok {
+			element["type"] = t
+		}
+	}
+	if len(bind) > 0 {
+		element["bind"] = bind
+	}
+	if len(control) > 0 {
+		element["control"] = control
+	}
+	return element, nil
+}
+
+func choiceList(val cue.Value) (string, []interface{}, error) {
+	listName, err := val.LookupPath(cue.ParsePath("list_name")).String()
+	if err != nil {
+		return "", nil, err
+	}
+	choicesIter, err := val.LookupPath(cue.ParsePath("choices")).List()
+	if err != nil {
+		return "", nil, err
+	}
+	list := []interface{}{}
+	for choicesIter.Next() {
+		choiceIter, err := choicesIter.Value().Fields()
+		if err != nil {
+			return "", nil, err
+		}
+		items := []map[string]interface{}{}
+		extra := map[string]interface{}{}
+		for choiceIter.Next() {
+			if choiceIter.Label() == "media" {
+				extra["media"], err = media(choiceIter.Value())
+				if err != nil {
+					return "", nil, err
+				}
+				continue
+			}
+			if choiceIter.Label() == "filterCategory" {
+				filters, err := choiceIter.Value().Fields()
+				if err != nil {
+					return "", nil, err
+				}
+				for filters.Next() {
+					extra[filters.Label()], err = xlsform.ValueString(filters.Value())
+					if err != nil {
+						return "", nil, err
+					}
+				}
+				continue
+			}
+			label, err := translatable(choiceIter.Value())
+			if err != nil {
+				return "", nil, err
+			}
+			items = append(items, map[string]interface{}{"name": choiceIter.Label(), "label": label})
+		}
+		for _, item := range items {
+			for k, v := range extra {
+				item[k] = v
+			}
+			list = append(list, item)
+		}
+	}
+	return listName, list, nil
+}
+
+func translatable(val cue.Value) (map[string]string, error) {
+	langs, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	texts := map[string]string{}
+	for langs.Next() {
+		texts[langs.Label()], err = langs.Value().String()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return texts, nil
+}
+
+// media returns the media of an element keyed by media type, files are either translated or the
+// same in every language
+func media(val cue.Value) (map[string]interface{}, error) {
+	mediaIter, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]interface{}{}
+	for mediaIter.Next() {
+		if mediaIter.Value().Kind() == cue.StringKind {
+			files[mediaIter.Label()], err = mediaIter.Value().String()
+		} else {
+			files[mediaIter.Label()], err = translatable(mediaIter.Value())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package pyxform
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "testdata/form.cue",
+			want: "testdata/form.json",
+		},
+		{
+			file: "testdata/media.cue",
+			want: "testdata/media.json",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			b, err := NewEncoder().Encode(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := b.String(); have != string(want) {
+				t.Fatalf("have\n%s\nwant\n%s", have, want)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	_, err := NewEncoder().Encode("testdata/invalid.cue")
+	if !errors.Is(err, xlsform.ErrMissingField) {
+		t.Fatalf("have %v, want %v", err, xlsform.ErrMissingField)
+	}
+	var encodeErrs xlsform.EncodeErrors
+	if !errors.As(err, &encodeErrs) {
+		t.Fatalf("have %T, want xlsform.EncodeErrors", err)
+	}
+	// the type of q1, the choices of q2 and the name of the question in father
+	if len(encodeErrs) != 3 {
+		t.Fatalf("have %d errors, want 3\n%v", len(encodeErrs), err)
+	}
+}
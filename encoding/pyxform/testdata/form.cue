@@ -0,0 +1,63 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+#Settings: {...}
+
+family_name: #Question & {
+	type: "text"
+	name: "family_name"
+	label: {
+		"English (en)":   "What's your family name?"
+		"Afrikaans (af)": "Wat is jou familienaam?"
+	}
+	required: "yes"
+	required_message: "English (en)": "We need a family name"
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	appearance: "field-list"
+	children: [
+		#Question & {
+			type: "select_one"
+			choices: #Choices & {
+				list_name: "yes_no"
+				choices: [
+					{
+						yes: "English (en)": "Yes"
+					},
+					{
+						no: "English (en)": "No"
+					},
+				]
+			}
+			name: "is_home"
+			label: "English (en)": "Is he home?"
+			relevant: "${family_name} != ''"
+		},
+	]
+}
+child: #Group & {
+	type:         "begin_repeat"
+	name:         "child"
+	label: "English (en)": "Child"
+	repeat_count: "2"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "Age"
+			constraint: ". < 18"
+		},
+	]
+}
+form_settings: #Settings & {
+	type:             "settings"
+	form_title:       "test"
+	form_id:          "test_id"
+	version:          "1"
+	default_language: "English (en)"
+}
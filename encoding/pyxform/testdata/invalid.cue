@@ -0,0 +1,25 @@
+package main
+
+#Question: {...}
+#Group: {...}
+
+q1: #Question & {
+	name: "q1"
+	label: "English (en)": "What's your name?"
+}
+q2: #Question & {
+	type: "select_one"
+	name: "q2"
+	label: "English (en)": "Do you smoke?"
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "integer"
+			label: "English (en)": "How old is your father?"
+		},
+	]
+}
@@ -0,0 +1,33 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+animal: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "animals"
+		choices: [
+			{
+				cow: "English (en)": "Cow"
+				media: image: "cow.png"
+			},
+			{
+				goat: "English (en)": "Goat"
+				media: audio: {
+					"English (en)": "goat.mp3"
+					"Swahili (sw)": "mbuzi.mp3"
+				}
+			},
+		]
+	}
+	name: "animal"
+	label: "English (en)": "Which animal is this?"
+	media: {
+		image: {
+			"English (en)": "animals.png"
+			"Swahili (sw)": "wanyama.png"
+		}
+		video: "animals.mp4"
+	}
+}
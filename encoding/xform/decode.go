@@ -0,0 +1,726 @@
+package xform
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+var (
+	itextRe   = regexp.MustCompile(`^jr:itext\('([^']+)'\)$`)
+	itemsetRe = regexp.MustCompile(`^instance\('([^']+)'\)/root/item(?:\[(.*)\])?$`)
+	itextIdRe = regexp.MustCompile(`^(.+)-\d+$`)
+
+	// untranslatedLang is the language we file labels that are not in the itext block under,
+	// it is the same name pyxform uses for them
+	untranslatedLang = "default"
+
+	surveyColumns  = []string{"type", "name", "label", "required", "required_message", "relevant", "repeat_count", "constraint", "constraint_message", "hint", "media", "choice_filter", "read_only", "calculation", "appearance", "default"}
+	choiceColumns  = []string{"list_name", "name", "label", "media"}
+	settingColumns = []string{"form_title", "form_id", "public_key", "submission_url", "default_language", "style", "version", "instance_name"}
+
+	inputTypes = map[string]string{
+		"string": "text", "int": "integer", "decimal": "decimal", "date": "date", "time": "time", "dateTime": "dateTime",
+		"geopoint": "geopoint", "geotrace": "geotrace", "geoshape": "geoshape", "barcode": "barcode",
+	}
+)
+
+type Decoder struct {
+	schemaPkg     string
+	attachmentDir string
+	typedValues   bool
+}
+
+// NewDecoder returns a new decoder that uses pkg as the xlsform schema definition package
+func NewDecoder(pkg string) *Decoder {
+	return &Decoder{schemaPkg: pkg}
+}
+
+// UsePkg changes the package we import schema definitions from
+func (d *Decoder) UsePkg(schemaPkg string) {
+	d.schemaPkg = schemaPkg
+}
+
+// UseAttachmentDir sets the directory we look for the csv files of choice lists loaded from a file and
+// of select_one_external lists in
+func (d *Decoder) UseAttachmentDir(dir string) {
+	d.attachmentDir = dir
+}
+
+// UseTypedValues makes the decoder infer bools and numbers for the typed survey columns
+func (d *Decoder) UseTypedValues(typed bool) {
+	d.typedValues = typed
+}
+
+// Decode returns the CUE encoding of the XForm XML in r. A read only text question is written the
+// same way as a note, so it comes back as a note unless it is also required or has a constraint
+func (d *Decoder) Decode(r io.Reader) ([]byte, error) {
+	html, err := parseXML(r)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := xformToSheets(html, d.attachmentDir)
+	if err != nil {
+		return nil, err
+	}
+	decoder := xlsform.NewDecoder(d.schemaPkg)
+	decoder.UseAttachmentDir(d.attachmentDir)
+	decoder.UseTypedValues(d.typedValues)
+	return decoder.DecodeSheets(sheets)
+}
+
+type decodeState struct {
+	pathRe        *regexp.Regexp
+	langs         []string
+	itext         map[string]map[string]string
+	media         map[string]map[string]map[string]string
+	binds         map[string]*node
+	controls      map[string]*node
+	repeats       map[string]*node
+	repeatCounts  map[string]string
+	skip          map[string]struct{}
+	instances     map[string]*node
+	actions       map[string]*node
+	survey        []map[string]string
+	surveyHeaders map[string]struct{}
+	choices       map[string][]map[string]string
+	choiceLists   []string
+	choiceHeaders map[string]struct{}
+	// lists of select_one_external questions, their choices are in csv attachments
+	externalLists []string
+}
+
+// xformToSheets converts an XForm document to the rows of the equivalent XLSForm sheets. The
+// choices of external lists are read from the csv files in attachmentDir
+func xformToSheets(html *node, attachmentDir string) (map[string][][]string, error) {
+	head, body := html.child("h:head"), html.child("h:body")
+	if head == nil || body == nil || head.child("model") == nil {
+		return nil, fmt.Errorf("missing head, model or body: %w", xlsform.ErrInvalidXLSForm)
+	}
+	model := head.child("model")
+	s := &decodeState{
+		itext:         map[string]map[string]string{},
+		media:         map[string]map[string]map[string]string{},
+		binds:         map[string]*node{},
+		controls:      map[string]*node{},
+		repeats:       map[string]*node{},
+		repeatCounts:  map[string]string{},
+		skip:          map[string]struct{}{},
+		instances:     map[string]*node{},
+		actions:       map[string]*node{},
+		surveyHeaders: map[string]struct{}{},
+		choices:       map[string][]map[string]string{},
+		choiceHeaders: map[string]struct{}{},
+	}
+	var data *node
+	for _, n := range model.children {
+		switch n.name {
+		case "itext":
+			s.readItext(n)
+		case "instance":
+			if id := n.getAttr("id"); id != "" {
+				s.instances[id] = n
+			} else if data == nil && len(n.children) > 0 {
+				data = n.children[0]
+			}
+		case "bind":
+			s.binds[n.getAttr("nodeset")] = n
+		case "odk:recordaudio":
+			s.actions[n.getAttr("ref")] = n
+		}
+	}
+	if data == nil {
+		return nil, fmt.Errorf("missing primary instance: %w", xlsform.ErrInvalidXLSForm)
+	}
+	root := "/" + data.name
+	s.pathRe = regexp.MustCompile(regexp.QuoteMeta(root) + `(?:/[\w.\-]+)+|current\(\)(?:/\.\.)+(?:/[\w.\-]+)+`)
+	s.collectControls(body)
+	for path, repeat := range s.repeats {
+		count := repeat.getAttr("jr:count")
+		if bind, ok := s.binds[count]; ok && count == path+"_count" && bind.getAttr("calculate") != "" {
+			s.skip[count] = struct{}{}
+			count = bind.getAttr("calculate")
+		}
+		if count != "" {
+			s.repeatCounts[path] = s.expr(count)
+		}
+	}
+	if err := s.decodeNodes(data, root); err != nil {
+		return nil, err
+	}
+
+	sheets := map[string][][]string{"survey": toSheetRows(s.survey, orderHeaders(s.surveyHeaders, surveyColumns, s.langs))}
+	if len(s.choiceLists) > 0 {
+		rows := []map[string]string{}
+		for _, list := range s.choiceLists {
+			rows = append(rows, s.choices[list]...)
+		}
+		sheets["choices"] = toSheetRows(rows, orderHeaders(s.choiceHeaders, choiceColumns, s.langs))
+	}
+	if len(s.externalLists) > 0 {
+		rows, err := s.externalChoices(attachmentDir)
+		if err != nil {
+			return nil, err
+		}
+		sheets["external_choices"] = rows
+	}
+	settings := s.settings(head, body, data)
+	settingHeaders := map[string]struct{}{}
+	for k := range settings {
+		settingHeaders[k] = struct{}{}
+	}
+	sheets["settings"] = toSheetRows([]map[string]string{settings}, orderHeaders(settingHeaders, settingColumns, s.langs))
+	return sheets, nil
+}
+
+func (s *decodeState) readItext(itext *node) {
+	for _, translation := range itext.children {
+		lang := translation.getAttr("lang")
+		if translation.getAttr("default") == "true()" {
+			s.langs = append([]string{lang}, s.langs...)
+		} else {
+			s.langs = append(s.langs, lang)
+		}
+		for _, text := range translation.children {
+			for _, value := range text.children {
+				if form := value.getAttr("form"); mediaPrefixes[form] != "" {
+					s.addMedia(text.getAttr("id"), form, lang, value.text)
+					continue
+				} else if form != "" && form != "long" {
+					continue
+				}
+				if value.text == "-" {
+					// pyxform's placeholder for a missing translation
+					continue
+				}
+				if s.itext[text.getAttr("id")] == nil {
+					s.itext[text.getAttr("id")] = map[string]string{}
+				}
+				s.itext[text.getAttr("id")][lang] = value.text
+			}
+		}
+	}
+}
+
+// addMedia records the media file of an itext value under its media type and language
+func (s *decodeState) addMedia(id, mediaType, lang, uri string) {
+	if s.media[id] == nil {
+		s.media[id] = map[string]map[string]string{}
+	}
+	if s.media[id][mediaType] == nil {
+		s.media[id][mediaType] = map[string]string{}
+	}
+	s.media[id][mediaType][lang] = strings.TrimPrefix(uri, mediaPrefixes[mediaType])
+}
+
+// sameInEveryLang returns the file when every language uses the same one
+func sameInEveryLang(files map[string]string, langs []string) (string, bool) {
+	if len(langs) < 2 || len(files) != len(langs) {
+		return "", false
+	}
+	file := files[langs[0]]
+	for _, lang := range langs {
+		if files[lang] != file {
+			return "", false
+		}
+	}
+	return file, true
+}
+
+// collectControls indexes the body controls, groups and repeats by the instance path they reference
+func (s *decodeState) collectControls(parent *node) {
+	for _, n := range parent.children {
+		switch n.name {
+		case "group":
+			if ref := n.getAttr("ref"); ref != "" {
+				s.controls[ref] = n
+			}
+			s.collectControls(n)
+		case "repeat":
+			s.repeats[n.getAttr("nodeset")] = n
+			s.collectControls(n)
+		case "input", "select1", "select", "upload", "trigger", "odk:rank":
+			s.controls[n.getAttr("ref")] = n
+		}
+	}
+}
+
+// decodeNodes walks the primary instance in document order and adds a survey row for every node
+func (s *decodeState) decodeNodes(parent *node, parentPath string) error {
+	seen := map[string]struct{}{}
+	for _, n := range parent.children {
+		path := parentPath + "/" + n.name
+		if _, ok := seen[path]; ok {
+			// the copy of a repeat that follows its jr:template
+			continue
+		}
+		seen[path] = struct{}{}
+		if _, ok := s.skip[path]; ok || n.name == "meta" {
+			continue
+		}
+		control := s.controls[path]
+		_, isRepeat := s.repeats[path]
+		if len(n.children) > 0 || isRepeat || (control != nil && control.name == "group") {
+			kind := "group"
+			if isRepeat {
+				kind = "repeat"
+			}
+			row := map[string]string{"type": "begin_" + kind, "name": n.name}
+			if control == nil {
+				control = s.repeats[path]
+			}
+			s.addControlColumns(row, control)
+			if err := s.addBindColumns(row, s.binds[path]); err != nil {
+				return err
+			}
+			if count, ok := s.repeatCounts[path]; ok {
+				row["repeat_count"] = count
+			}
+			s.addRow(row)
+			if err := s.decodeNodes(n, path); err != nil {
+				return err
+			}
+			s.addRow(map[string]string{"type": "end_" + kind})
+			continue
+		}
+		row, err := s.questionRow(n, path)
+		if err != nil {
+			return err
+		}
+		s.addRow(row)
+	}
+	return nil
+}
+
+func (s *decodeState) questionRow(n *node, path string) (map[string]string, error) {
+	bind, control := s.binds[path], s.controls[path]
+	if bind == nil {
+		bind = newNode("bind", "nodeset", path, "type", "string")
+	}
+	row := map[string]string{"name": n.name}
+	qtype, err := s.questionType(path, bind, control)
+	if err != nil {
+		return nil, err
+	}
+	row["type"] = qtype
+	if err := s.addBindColumns(row, bind); err != nil {
+		return nil, err
+	}
+	if qtype == "note" {
+		// notes are always read only
+		delete(row, "read_only")
+	}
+	s.addControlColumns(row, control)
+	if strings.HasPrefix(qtype, "select_") || qtype == "rank" {
+		listName, err := s.addChoices(row, n.name, control)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(listName, ".csv") && !strings.HasSuffix(qtype, "_from_file") {
+			qtype = fmt.Sprintf("%s_from_file", qtype)
+		}
+		row["type"] = fmt.Sprintf("%s %s", qtype, listName)
+	}
+	if text := strings.TrimSpace(n.text); text != "" {
+		row["default"] = text
+	}
+	return row, nil
+}
+
+func (s *decodeState) questionType(path string, bind, control *node) (string, error) {
+	if preload := bind.getAttr("jr:preload"); preload != "" {
+		params := bind.getAttr("jr:preloadParams")
+		for qtype, p := range metadataPreloads {
+			if p[0] == preload && p[1] == params {
+				return qtype, nil
+			}
+		}
+		return "", fmt.Errorf("%s %s %s: %w", path, preload, params, ErrUnsupportedType)
+	}
+	bindType := strings.TrimPrefix(bind.getAttr("type"), "xsd:")
+	if control == nil {
+		if _, ok := s.actions[path]; ok {
+			return "background-audio", nil
+		}
+		if bind.getAttr("calculate") != "" {
+			return "calculate", nil
+		}
+		return "hidden", nil
+	}
+	switch control.name {
+	case "select1":
+		return "select_one", nil
+	case "select":
+		return "select_multiple", nil
+	case "odk:rank":
+		return "rank", nil
+	case "trigger":
+		return "acknowledge", nil
+	case "upload":
+		mediatype := strings.Split(control.getAttr("mediatype"), "/")[0]
+		switch mediatype {
+		case "image", "audio", "video":
+			return mediatype, nil
+		}
+		return "file", nil
+	}
+	if control.getAttr("query") != "" {
+		// an input that searches an external list, the way pyxform writes select_one_external
+		return "select_one_external", nil
+	}
+	if bindType == "string" && bind.getAttr("readonly") == "true()" && bind.getAttr("calculate") == "" && !isAnswered(bind) {
+		return "note", nil
+	}
+	if qtype, ok := inputTypes[bindType]; ok {
+		return qtype, nil
+	}
+	return "", fmt.Errorf("%s %s: %w", path, bindType, ErrUnsupportedType)
+}
+
+// isAnswered reports whether bind has the required or constraint of a question that takes an
+// answer, which a note can't have
+func isAnswered(bind *node) bool {
+	required := bind.getAttr("required")
+	return (required != "" && required != "false()") || bind.getAttr("constraint") != ""
+}
+
+func (s *decodeState) addBindColumns(row map[string]string, bind *node) error {
+	if bind == nil {
+		return nil
+	}
+	for _, a := range [][2]string{{"relevant", "relevant"}, {"constraint", "constraint"}, {"calculate", "calculation"}} {
+		if val := bind.getAttr(a[0]); val != "" {
+			row[a[1]] = s.expr(val)
+		}
+	}
+	for _, a := range [][2]string{{"required", "required"}, {"readonly", "read_only"}} {
+		switch val := bind.getAttr(a[0]); val {
+		case "", "false()":
+		case "true()":
+			row[a[1]] = "yes"
+		default:
+			row[a[1]] = s.expr(val)
+		}
+	}
+	s.addTranslated(row, "constraint_message", bind.getAttr("jr:constraintMsg"))
+	s.addTranslated(row, "required_message", bind.getAttr("jr:requiredMsg"))
+	return nil
+}
+
+func (s *decodeState) addControlColumns(row map[string]string, control *node) {
+	if control == nil {
+		return
+	}
+	if appearance := control.getAttr("appearance"); appearance != "" {
+		row["appearance"] = appearance
+	}
+	for _, col := range []string{"label", "hint"} {
+		if n := control.child(col); n != nil {
+			if ref := n.getAttr("ref"); ref != "" {
+				s.addTranslated(row, col, ref)
+			} else {
+				s.addTranslated(row, col, n.text)
+			}
+		}
+	}
+}
+
+// addTranslated adds the texts of an itext reference or of a plain text to the translatable column
+func (s *decodeState) addTranslated(row map[string]string, column, textOrRef string) {
+	if textOrRef == "" {
+		return
+	}
+	if match := itextRe.FindStringSubmatch(textOrRef); match != nil {
+		for lang, text := range s.itext[match[1]] {
+			row[fmt.Sprintf("%s::%s", column, lang)] = text
+		}
+		for mediaType, files := range s.media[match[1]] {
+			if file, ok := sameInEveryLang(files, s.langs); ok {
+				row[fmt.Sprintf("media::%s", mediaType)] = file
+				continue
+			}
+			for lang, file := range files {
+				row[fmt.Sprintf("media::%s::%s", mediaType, lang)] = file
+			}
+		}
+		return
+	}
+	lang := untranslatedLang
+	if len(s.langs) > 0 {
+		lang = s.langs[0]
+	}
+	row[fmt.Sprintf("%s::%s", column, lang)] = textOrRef
+}
+
+// externalChoices reads the rows of the external_choices sheet back from the <list_name>.csv
+// attachments the XForm loads them from. A label column with no language is in the default one
+func (s *decodeState) externalChoices(attachmentDir string) ([][]string, error) {
+	rows := []map[string]string{}
+	headers := map[string]struct{}{"list_name": {}}
+	for _, listName := range s.externalLists {
+		file := fmt.Sprintf("%s.csv", listName)
+		if attachmentDir == "" {
+			return nil, fmt.Errorf("select_one_external %s: missing attachment %s: %w", listName, file, ErrUnsupportedType)
+		}
+		b, err := os.ReadFile(filepath.Join(attachmentDir, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("select_one_external %s: missing attachment %s: %w", listName, file, ErrUnsupportedType)
+		} else if err != nil {
+			return nil, err
+		}
+		r := csv.NewReader(bytes.NewReader(b))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v: %w", file, err, xlsform.ErrInvalidXLSForm)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("%s: empty file: %w", file, xlsform.ErrInvalidXLSForm)
+		}
+		for _, record := range records[1:] {
+			row := map[string]string{"list_name": listName}
+			for idx, column := range records[0] {
+				if idx >= len(record) || record[idx] == "" {
+					continue
+				}
+				if column == "label" {
+					s.addTranslated(row, column, record[idx])
+				} else {
+					row[column] = record[idx]
+				}
+			}
+			for k := range row {
+				headers[k] = struct{}{}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return toSheetRows(rows, orderHeaders(headers, choiceColumns, s.langs)), nil
+}
+
+// addChoices adds the choice list of a select to the choice rows and returns its list name
+func (s *decodeState) addChoices(row map[string]string, name string, control *node) (string, error) {
+	var (
+		listName string
+		rows     []map[string]string
+	)
+	if query := control.getAttr("query"); query != "" {
+		match := itemsetRe.FindStringSubmatch(query)
+		if match == nil {
+			return "", fmt.Errorf("%s query %s: %w", name, query, ErrUnsupportedType)
+		}
+		if match[2] != "" {
+			row["choice_filter"] = s.expr(match[2])
+		}
+		// the choices are not in the form, Decode reads them from the list's csv attachment
+		if !slices.Contains(s.externalLists, match[1]) {
+			s.externalLists = append(s.externalLists, match[1])
+		}
+		return match[1], nil
+	}
+	if itemset := control.child("itemset"); itemset != nil {
+		match := itemsetRe.FindStringSubmatch(itemset.getAttr("nodeset"))
+		if match == nil {
+			return "", fmt.Errorf("%s itemset %s: %w", name, itemset.getAttr("nodeset"), ErrUnsupportedType)
+		}
+		listName = match[1]
+		if match[2] != "" {
+			row["choice_filter"] = s.expr(match[2])
+		}
+		instance, ok := s.instances[listName]
+		if !ok {
+			return "", fmt.Errorf("%s choices from %s: %w", name, listName, ErrUnsupportedType)
+		}
+		if src := instance.getAttr("src"); strings.HasPrefix(src, "jr://file-csv/") {
+			// the choices are in a csv attachment, the decoder reads it back if it has it
+			return strings.TrimPrefix(src, "jr://file-csv/"), nil
+		}
+		if instance.getAttr("src") != "" || instance.child("root") == nil {
+			return "", fmt.Errorf("%s choices from %s: %w", name, listName, ErrUnsupportedType)
+		}
+		for _, item := range instance.child("root").children {
+			choice := map[string]string{"list_name": listName}
+			for _, col := range item.children {
+				switch col.name {
+				case "name":
+					choice["name"] = col.text
+				case "itextId":
+					s.addTranslated(choice, "label", fmt.Sprintf("jr:itext('%s')", col.text))
+				case "label":
+					s.addTranslated(choice, "label", col.text)
+				default:
+					choice[col.name] = col.text
+				}
+			}
+			rows = append(rows, choice)
+		}
+	} else {
+		// inline items carry no list name, we recover it from itext ids like yes_no-0
+		listName = name
+		firstRef := ""
+		for _, item := range control.children {
+			if item.name != "item" {
+				continue
+			}
+			choice := map[string]string{}
+			if value := item.child("value"); value != nil {
+				choice["name"] = value.text
+			}
+			if label := item.child("label"); label != nil {
+				if ref := label.getAttr("ref"); ref != "" {
+					if firstRef == "" {
+						firstRef = ref
+					}
+					s.addTranslated(choice, "label", ref)
+				} else {
+					s.addTranslated(choice, "label", label.text)
+				}
+			}
+			rows = append(rows, choice)
+		}
+		if match := itextIdRe.FindStringSubmatch(itextRe.ReplaceAllString(firstRef, "$1")); match != nil {
+			listName = match[1]
+		}
+		for _, choice := range rows {
+			choice["list_name"] = listName
+		}
+	}
+	if existing, ok := s.choices[listName]; ok {
+		if sameRows(existing, rows) {
+			return listName, nil
+		}
+		// same list name with different choices, keep them apart under the question's name
+		listName = name
+		for _, choice := range rows {
+			choice["list_name"] = listName
+		}
+	}
+	for _, choice := range rows {
+		for k := range choice {
+			s.choiceHeaders[k] = struct{}{}
+		}
+	}
+	s.choices[listName] = rows
+	s.choiceLists = append(s.choiceLists, listName)
+	return listName, nil
+}
+
+func (s *decodeState) settings(head, body, data *node) map[string]string {
+	settings := map[string]string{"form_id": data.getAttr("id")}
+	if title := head.child("h:title"); title != nil && title.text != "" {
+		settings["form_title"] = title.text
+	}
+	if version := data.getAttr("version"); version != "" {
+		settings["version"] = version
+	}
+	if len(s.itext) > 0 && len(s.langs) > 0 {
+		settings["default_language"] = s.langs[0]
+	}
+	if style := body.getAttr("class"); style != "" {
+		settings["style"] = style
+	}
+	if bind, ok := s.binds[fmt.Sprintf("/%s/meta/instanceName", data.name)]; ok {
+		settings["instance_name"] = s.expr(bind.getAttr("calculate"))
+	}
+	if submission := head.child("model").child("submission"); submission != nil {
+		if action := submission.getAttr("action"); action != "" {
+			settings["submission_url"] = action
+		}
+		if key := submission.getAttr("base64RsaPublicKey"); key != "" {
+			settings["public_key"] = key
+		}
+	}
+	return settings
+}
+
+func (s *decodeState) addRow(row map[string]string) {
+	for k := range row {
+		s.surveyHeaders[k] = struct{}{}
+	}
+	s.survey = append(s.survey, row)
+}
+
+// expr rewrites the instance paths in an xpath expression to ${name} references
+func (s *decodeState) expr(e string) string {
+	return s.pathRe.ReplaceAllStringFunc(e, pathToRef)
+}
+
+func pathToRef(path string) string {
+	segments := strings.Split(strings.TrimSpace(path), "/")
+	return fmt.Sprintf("${%s}", segments[len(segments)-1])
+}
+
+func sameRows(a, b []map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for k, v := range a[i] {
+			if b[i][k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// orderHeaders orders the column headers the same way the xlsform encoder does, translatable
+// columns follow the order of langs
+func orderHeaders(headers map[string]struct{}, order []string, langs []string) []string {
+	ordered := []string{}
+	for _, col := range order {
+		columns := []string{col}
+		if col == "media" {
+			// media columns look like media::image::English (en)
+			columns = []string{}
+			for _, mediaType := range xlsform.MediaTypes {
+				columns = append(columns, "media::"+mediaType)
+			}
+		}
+		for _, col := range columns {
+			if _, ok := headers[col]; ok {
+				ordered = append(ordered, col)
+				delete(headers, col)
+			}
+			for _, lang := range append(append([]string{}, langs...), untranslatedLang) {
+				header := fmt.Sprintf("%s::%s", col, lang)
+				if _, ok := headers[header]; ok {
+					ordered = append(ordered, header)
+					delete(headers, header)
+				}
+			}
+		}
+	}
+	rest := []string{}
+	for header := range headers {
+		rest = append(rest, header)
+	}
+	sort.Strings(rest)
+	return append(ordered, rest...)
+}
+
+func toSheetRows(rows []map[string]string, headers []string) [][]string {
+	sheet := [][]string{headers}
+	for _, row := range rows {
+		r := make([]string, len(headers))
+		for i, header := range headers {
+			r[i] = row[header]
+		}
+		sheet = append(sheet, r)
+	}
+	return sheet
+}
@@ -0,0 +1,321 @@
+package xform
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		file string
+		want string
+		err  error
+	}{
+		{
+			file: "testdata/form.xml",
+			want: `package main
+
+import "test"
+
+family_name:
+	test.#Question & {
+		type: "text"
+		name: "family_name"
+		label: {
+			"English (en)":   "What's your family name?"
+			"Afrikaans (af)": "Wat is jou familienaam?"
+		}
+		required: "yes"
+		required_message: "English (en)": "We need a family name"
+	}
+father:
+	test.#Group & {
+		type: "begin_group"
+		name: "father"
+		label: "English (en)": "Father"
+		appearance: "field-list"
+		children: [
+			test.#Question & {
+				type: "integer"
+				name: "age"
+				label: "English (en)": "How old is your father?"
+				constraint: ". > 18"
+				constraint_message: "English (en)": "Too young to be a father"
+			},
+			test.#Question & {
+				type:    "select_one"
+				choices: yes_no
+				name:    "is_home"
+				label: "English (en)": "Is he home?"
+				relevant: "${age} > 40"
+			},
+		]
+	}
+child:
+	test.#Group & {
+		type: "begin_repeat"
+		name: "child"
+		label: "English (en)": "Child"
+		repeat_count: "${age} div 10"
+		children: [
+			test.#Question & {
+				type: "text"
+				name: "child_name"
+				label: "English (en)": "Name"
+				hint: "English (en)": "First name of ${family_name}'s child"
+			},
+		]
+	}
+yes_no: test.#Choices & {
+	list_name: "yes_no"
+	choices: [
+		{
+			yes: "English (en)": "Yes"
+		},
+		{
+			no: "English (en)": "No"
+		},
+	]
+}
+form_settings:
+	test.#Settings & {
+		type:             "settings"
+		form_title:       "test"
+		form_id:          "test_id"
+		default_language: "English (en)"
+		version:          "1"
+		instance_name:    "concat(${family_name}, '-', ${age})"
+	}
+`,
+		},
+		{
+			file: "testdata/cascade.xml",
+			want: `package main
+
+import "test"
+
+county:
+	test.#Question & {
+		type: "text"
+		name: "county"
+		label: default: "County"
+		required: "yes"
+	}
+ward:
+	test.#Question & {
+		type:    "select_one"
+		choices: wards
+		name:    "ward"
+		label: default: "Ward in ${county}"
+		choice_filter: "county= ${county} "
+	}
+start:
+	test.#Question & {
+		type: "start"
+		name: "start"
+	}
+wards: test.#Choices & {
+	list_name: "wards"
+	choices: [
+		{
+			kilimani: default: "Kilimani"
+			filterCategory: county: "nairobi"
+		},
+		{
+			nyali: default: "Nyali"
+			filterCategory: county: "mombasa"
+		},
+	]
+}
+form_settings:
+	test.#Settings & {
+		type:       "settings"
+		form_title: "Cascade"
+		form_id:    "cascade"
+	}
+`,
+		},
+		{
+			file: "testdata/media.xml",
+			want: `package main
+
+import "test"
+
+animal:
+	test.#Question & {
+		type:    "select_one"
+		choices: animals
+		name:    "animal"
+		label: "English (en)": "Which animal is this?"
+		media: {
+			image: {
+				"English (en)": "animals.png"
+				"Swahili (sw)": "wanyama.png"
+			}
+			video: "animals.mp4"
+		}
+	}
+animals: test.#Choices & {
+	list_name: "animals"
+	choices: [
+		{
+			cow: "English (en)": "Cow"
+			media: image: "cow.png"
+		},
+		{
+			goat: "English (en)": "Goat"
+			media: audio: {
+				"English (en)": "goat.mp3"
+				"Swahili (sw)": "mbuzi.mp3"
+			}
+		},
+	]
+}
+form_settings:
+	test.#Settings & {
+		type:             "settings"
+		form_title:       "data"
+		form_id:          "data"
+		default_language: "English (en)"
+	}
+`,
+		},
+		{
+			file: "testdata/read_only.xml",
+			want: `package main
+
+import "test"
+
+intro:
+	test.#Question & {
+		type: "note"
+		name: "intro"
+		label: default: "Welcome"
+	}
+household_id:
+	test.#Question & {
+		type: "text"
+		name: "household_id"
+		label: default: "Household ID"
+		required:  "yes"
+		read_only: "yes"
+	}
+code:
+	test.#Question & {
+		type: "text"
+		name: "code"
+		label: default: "Code"
+		constraint: "string-length(.) = 4"
+		read_only:  "yes"
+	}
+form_settings:
+	test.#Settings & {
+		type:       "settings"
+		form_title: "Read only"
+		form_id:    "read_only"
+	}
+`,
+		},
+		{
+			file: "testdata/invalid.xml",
+			err:  ErrUnsupportedType,
+		},
+		{
+			file: "testdata/missing_instance.xml",
+			err:  ErrUnsupportedType,
+		},
+	}
+	decoder := NewDecoder("test")
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			content, err := os.Open(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := decoder.Decode(content)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %s, want %s", err, tc.err)
+			}
+			if have := string(r); tc.want != "" && have != tc.want {
+				t.Fatalf("%s\n\nhave %q\nwant %q", have, have, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	html, err := parseXML(strings.NewReader(`<h:html xmlns:h="http://www.w3.org/1999/xhtml"><h:body><label>Hi <output value="/data/a/name"/>!</label></h:body></h:html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := html.child("h:body").child("label").text; have != "Hi ${name}!" {
+		t.Fatalf("have %q", have)
+	}
+}
+
+func TestDecodeExternal(t *testing.T) {
+	b, err := NewEncoder().Encode("testdata/external.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := NewDecoder("test")
+	if _, err := decoder.Decode(bytes.NewReader(b.Bytes())); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("have %v without the ward.csv attachment, want %s", err, ErrUnsupportedType)
+	}
+	decoder.UseAttachmentDir("testdata")
+	r, err := decoder.Decode(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package main
+
+import "test"
+
+county:
+	test.#Question & {
+		type:    "select_one"
+		choices: county_choices
+		name:    "county"
+		label: "English (en)": "County"
+	}
+ward:
+	test.#Question & {
+		type:    "select_one_external"
+		choices: ward_choices
+		name:    "ward"
+		label: "English (en)": "Ward"
+		choice_filter: "county=${county}"
+	}
+county_choices: test.#Choices & {
+	list_name: "county"
+	choices: [
+		{
+			nairobi: "English (en)": "Nairobi"
+		},
+	]
+}
+ward_choices: test.#Choices & {
+	list_name: "ward"
+	external:  true
+	choices: [
+		{
+			kilimani: "English (en)": "Kilimani"
+			filterCategory: county: "nairobi"
+		},
+	]
+}
+form_settings:
+	test.#Settings & {
+		type:             "settings"
+		form_title:       "data"
+		form_id:          "data"
+		default_language: "English (en)"
+	}
+`
+	if have := string(r); have != want {
+		t.Fatalf("%s\n\nhave %q\nwant %q", have, have, want)
+	}
+}
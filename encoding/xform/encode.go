@@ -0,0 +1,689 @@
+package xform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+var (
+	ErrUnsupportedType  = errors.New("question type not supported in xforms")
+	ErrUnknownReference = errors.New("expression references an unknown field")
+
+	refRe = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+	rootNodeName = "data"
+
+	// bindTypes maps xlsform question types to the xforms data type of the bind
+	bindTypes = map[string]string{
+		"text": "string", "integer": "int", "decimal": "decimal", "date": "date", "time": "time", "dateTime": "dateTime",
+		"geopoint": "geopoint", "geotrace": "geotrace", "geoshape": "geoshape", "note": "string", "barcode": "barcode",
+		"acknowledge": "string", "calculate": "string", "hidden": "string", "rank": "odk:rank",
+		"select_one": "string", "select_multiple": "string", "select_one_from_file": "string", "select_multiple_from_file": "string", "select_one_external": "string",
+		"image": "binary", "audio": "binary", "background-audio": "binary", "video": "binary", "file": "binary",
+		"start": "dateTime", "end": "dateTime", "today": "date", "deviceid": "string", "username": "string", "phonenumber": "string", "email": "string",
+	}
+	uploadMediaTypes = map[string]string{"image": "image/*", "audio": "audio/*", "video": "video/*", "file": "application/*"}
+	// mediaPrefixes are the jr:// uris media files of each itext value form are referenced under
+	mediaPrefixes = map[string]string{"image": "jr://images/", "big-image": "jr://images/", "audio": "jr://audio/", "video": "jr://video/"}
+	// metadataPreloads holds the jr:preload and jr:preloadParams of the metadata question types
+	metadataPreloads = map[string][2]string{
+		"start": {"timestamp", "start"}, "end": {"timestamp", "end"}, "today": {"date", "today"},
+		"deviceid": {"property", "deviceid"}, "username": {"property", "username"}, "phonenumber": {"property", "phonenumber"}, "email": {"property", "email"},
+	}
+)
+
+// element is a survey element read from the CUE form
+type element struct {
+	kind         string
+	name         string
+	path         string
+	columns      map[string]string
+	translations map[string]map[string]string
+	media        map[string]map[string]string
+	choices      *choiceList
+	children     []*element
+}
+
+func (el *element) isGroup() bool {
+	return el.kind == "begin_group" || el.kind == "begin_repeat"
+}
+
+type choiceList struct {
+	name     string
+	fromFile bool
+	items    []*choiceItem
+}
+
+type choiceItem struct {
+	name   string
+	labels map[string]string
+	media  map[string]map[string]string
+	extra  map[string]string
+}
+
+type itextEntry struct {
+	id    string
+	texts map[string]string
+	// media maps a media type to its file in each language, an empty language applies to all of them
+	media map[string]map[string]string
+}
+
+type encodeState struct {
+	langs       []string
+	paths       map[string]string
+	itext       []itextEntry
+	textIds     map[string]struct{}
+	instances   map[string]*node
+	instanceIds []string
+	binds       []*node
+	actions     []*node
+}
+
+type Encoder struct{}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Encode returns the ODK XForm equivalent of the CUE file at filePath
+func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+	source, err := xlsform.ParseCueForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeForm(source)
+}
+
+// EncodeForm returns the ODK XForm equivalent of form
+func (encoder *Encoder) EncodeForm(form *xlsform.CueForm) (*bytes.Buffer, error) {
+	state := &encodeState{paths: map[string]string{}, textIds: map[string]struct{}{}, instances: map[string]*node{}}
+	settings := map[string]string{}
+	if form.Settings != nil {
+		s, err := state.readElement(*form.Settings, "")
+		if err != nil {
+			return nil, err
+		}
+		settings = s.columns
+		if lang, ok := settings["default_language"]; ok {
+			state.addLang(lang, true)
+		}
+	}
+	elements := []*element{}
+	for _, val := range form.SurveyElements {
+		el, err := state.readElement(*val, "/"+rootNodeName)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, el)
+	}
+	html, err := state.document(settings, elements)
+	if err != nil {
+		return nil, err
+	}
+	b := &bytes.Buffer{}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	html.write(b, 0)
+	return b, nil
+}
+
+// readElement reads the CUE value of a survey element, its choices and its children into an element
+func (s *encodeState) readElement(val cue.Value, parent string) (*element, error) {
+	el := &element{columns: map[string]string{}, translations: map[string]map[string]string{}}
+	fields, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	children := []cue.Value{}
+	for fields.Next() {
+		key := fields.Label()
+		switch {
+		case key == "children":
+			iter, err := fields.Value().List()
+			if err != nil {
+				return nil, err
+			}
+			for iter.Next() {
+				children = append(children, iter.Value())
+			}
+		case key == "choices":
+			el.choices, err = s.readChoices(fields.Value())
+			if err != nil {
+				return nil, err
+			}
+		case key == "media":
+			el.media, err = s.readMedia(fields.Value())
+			if err != nil {
+				return nil, err
+			}
+		case xlsform.IsTranslatableColumn(key):
+			texts, err := s.readTranslatable(fields.Value())
+			if err != nil {
+				return nil, err
+			}
+			el.translations[key] = texts
+		default:
+			el.columns[key], err = xlsform.ValueString(fields.Value())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	el.kind = strings.ReplaceAll(el.columns["type"], " ", "_")
+	el.name = el.columns["name"]
+	delete(el.columns, "type")
+	delete(el.columns, "name")
+	if parent == "" {
+		return el, nil
+	}
+	el.path = fmt.Sprintf("%s/%s", parent, el.name)
+	if _, exists := s.paths[el.name]; exists {
+		// ${name} references become ambiguous, we only complain if someone uses them
+		s.paths[el.name] = ""
+	} else {
+		s.paths[el.name] = el.path
+	}
+	for _, child := range children {
+		c, err := s.readElement(child, el.path)
+		if err != nil {
+			return nil, err
+		}
+		el.children = append(el.children, c)
+	}
+	return el, nil
+}
+
+func (s *encodeState) readTranslatable(val cue.Value) (map[string]string, error) {
+	langs, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	texts := map[string]string{}
+	for langs.Next() {
+		texts[langs.Label()], err = langs.Value().String()
+		if err != nil {
+			return nil, err
+		}
+		s.addLang(langs.Label(), false)
+	}
+	return texts, nil
+}
+
+func (s *encodeState) readChoices(val cue.Value) (*choiceList, error) {
+	listName, err := val.LookupPath(cue.ParsePath("list_name")).String()
+	if err != nil {
+		return nil, err
+	}
+	list := &choiceList{name: listName}
+	list.fromFile, _ = val.LookupPath(cue.ParsePath("from_file")).Bool()
+	choicesIter, err := val.LookupPath(cue.ParsePath("choices")).List()
+	if err != nil {
+		return nil, err
+	}
+	for choicesIter.Next() {
+		choiceIter, err := choicesIter.Value().Fields()
+		if err != nil {
+			return nil, err
+		}
+		items := []*choiceItem{}
+		extra := map[string]string{}
+		var media map[string]map[string]string
+		for choiceIter.Next() {
+			if choiceIter.Label() == "media" {
+				media, err = s.readMedia(choiceIter.Value())
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if choiceIter.Label() == "filterCategory" {
+				filters, err := choiceIter.Value().Fields()
+				if err != nil {
+					return nil, err
+				}
+				for filters.Next() {
+					extra[filters.Label()], err = xlsform.ValueString(filters.Value())
+					if err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			labels, err := s.readTranslatable(choiceIter.Value())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, &choiceItem{name: choiceIter.Label(), labels: labels, extra: extra})
+		}
+		for _, item := range items {
+			item.media = media
+		}
+		list.items = append(list.items, items...)
+	}
+	return list, nil
+}
+
+// readMedia reads the media files of an element or choice, untranslated files are kept under an
+// empty language
+func (s *encodeState) readMedia(val cue.Value) (map[string]map[string]string, error) {
+	mediaIter, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	media := map[string]map[string]string{}
+	for mediaIter.Next() {
+		if mediaIter.Value().Kind() == cue.StringKind {
+			file, err := mediaIter.Value().String()
+			if err != nil {
+				return nil, err
+			}
+			media[mediaIter.Label()] = map[string]string{"": file}
+			continue
+		}
+		media[mediaIter.Label()], err = s.readTranslatable(mediaIter.Value())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+func (s *encodeState) addLang(lang string, isDefault bool) {
+	for i, l := range s.langs {
+		if l != lang {
+			continue
+		}
+		if isDefault && i != 0 {
+			s.langs = append([]string{lang}, append(s.langs[:i], s.langs[i+1:]...)...)
+		}
+		return
+	}
+	if isDefault {
+		s.langs = append([]string{lang}, s.langs...)
+	} else {
+		s.langs = append(s.langs, lang)
+	}
+}
+
+// expr rewrites the ${name} references in an xlsform expression to absolute instance paths
+func (s *encodeState) expr(e string) (string, error) {
+	var err error
+	result := refRe.ReplaceAllStringFunc(e, func(ref string) string {
+		name := refRe.FindStringSubmatch(ref)[1]
+		path, ok := s.paths[name]
+		if !ok || path == "" {
+			err = fmt.Errorf("%s: %w", ref, ErrUnknownReference)
+			return ref
+		}
+		return path
+	})
+	return result, err
+}
+
+// outputs escapes text for use as an itext value and turns its ${name} references into <output/> tags
+func (s *encodeState) outputs(text string) (string, error) {
+	var err error
+	value := refRe.ReplaceAllStringFunc(textEscaper.Replace(text), func(ref string) string {
+		path, e := s.expr(ref)
+		if e != nil {
+			err = e
+			return ref
+		}
+		return fmt.Sprintf(`<output value="%s"/>`, path)
+	})
+	return value, err
+}
+
+// addText adds texts to the itext translations under id and returns the reference to it
+func (s *encodeState) addText(id string, texts map[string]string) string {
+	return s.addMediaText(id, texts, nil)
+}
+
+// addMediaText is addText for labels that come with media files
+func (s *encodeState) addMediaText(id string, texts map[string]string, media map[string]map[string]string) string {
+	if _, exists := s.textIds[id]; !exists {
+		s.textIds[id] = struct{}{}
+		s.itext = append(s.itext, itextEntry{id: id, texts: texts, media: media})
+	}
+	return fmt.Sprintf("jr:itext('%s')", id)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *encodeState) document(settings map[string]string, elements []*element) (*node, error) {
+	formId := settings["form_id"]
+	if formId == "" {
+		formId = rootNodeName
+	}
+	data := newNode(rootNodeName, "id", formId)
+	if version, ok := settings["version"]; ok {
+		data.setAttr("version", version)
+	}
+	body := newNode("h:body")
+	if style, ok := settings["style"]; ok {
+		body.setAttr("class", style)
+	}
+	for _, el := range elements {
+		if err := s.encodeElement(el, data, body); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := newNode("meta").add(newNode("instanceID"))
+	s.binds = append(s.binds, newNode("bind", "jr:preload", "uid", "nodeset", fmt.Sprintf("/%s/meta/instanceID", rootNodeName), "readonly", "true()", "type", "string"))
+	if instanceName, ok := settings["instance_name"]; ok {
+		calculation, err := s.expr(instanceName)
+		if err != nil {
+			return nil, err
+		}
+		meta.add(newNode("instanceName"))
+		s.binds = append(s.binds, newNode("bind", "calculate", calculation, "nodeset", fmt.Sprintf("/%s/meta/instanceName", rootNodeName), "type", "string"))
+	}
+	data.add(meta)
+
+	model := newNode("model", "odk:xforms-version", "1.0.0")
+	if len(s.itext) > 0 {
+		itext := newNode("itext")
+		for i, lang := range s.langs {
+			translation := newNode("translation", "lang", lang)
+			if i == 0 {
+				translation.setAttr("default", "true()")
+			}
+			for _, entry := range s.itext {
+				text, ok := entry.texts[lang]
+				if !ok {
+					text = "-"
+				}
+				value, err := s.outputs(text)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", entry.id, err)
+				}
+				textNode := newNode("text", "id", entry.id).add(newNode("value").setRaw(value))
+				for _, mediaType := range xlsform.MediaTypes {
+					files := entry.media[mediaType]
+					file, ok := files[lang]
+					if !ok {
+						file, ok = files[""]
+					}
+					if ok {
+						textNode.add(newNode("value", "form", mediaType).setText(mediaPrefixes[mediaType] + file))
+					}
+				}
+				translation.add(textNode)
+			}
+			itext.add(translation)
+		}
+		model.add(itext)
+	}
+	model.add(newNode("instance").add(data))
+	for _, id := range s.instanceIds {
+		model.add(s.instances[id])
+	}
+	model.add(s.binds...)
+	model.add(s.actions...)
+	if url, ok := settings["submission_url"]; ok {
+		submission := newNode("submission", "action", url, "method", "post")
+		if key, ok := settings["public_key"]; ok {
+			submission.setAttr("base64RsaPublicKey", key)
+		}
+		model.add(submission)
+	} else if key, ok := settings["public_key"]; ok {
+		model.add(newNode("submission", "base64RsaPublicKey", key, "method", "post"))
+	}
+
+	title := settings["form_title"]
+	if title == "" {
+		title = formId
+	}
+	head := newNode("h:head").add(newNode("h:title").setText(title), model)
+	return newNode("h:html",
+		"xmlns", "http://www.w3.org/2002/xforms",
+		"xmlns:ev", "http://www.w3.org/2001/xml-events",
+		"xmlns:h", "http://www.w3.org/1999/xhtml",
+		"xmlns:jr", "http://openrosa.org/javarosa",
+		"xmlns:odk", "http://www.opendatakit.org/xforms",
+		"xmlns:orx", "http://openrosa.org/xforms",
+		"xmlns:xsd", "http://www.w3.org/2001/XMLSchema",
+	).add(head, body), nil
+}
+
+// encodeElement adds the instance node, binds and body control of el to the form
+func (s *encodeState) encodeElement(el *element, instance, body *node) error {
+	if el.isGroup() {
+		return s.encodeGroup(el, instance, body)
+	}
+	bindType, ok := bindTypes[el.kind]
+	if !ok {
+		return fmt.Errorf("%s %q: %w", el.name, el.kind, ErrUnsupportedType)
+	}
+	instance.add(newNode(el.name).setText(el.columns["default"]))
+
+	bind := newNode("bind", "nodeset", el.path, "type", bindType)
+	if err := s.addBindExprs(el, bind); err != nil {
+		return err
+	}
+	if preload, ok := metadataPreloads[el.kind]; ok {
+		bind.setAttr("jr:preload", preload[0]).setAttr("jr:preloadParams", preload[1])
+	}
+	if el.kind == "note" {
+		bind.setAttr("readonly", "true()")
+	}
+	s.binds = append(s.binds, bind)
+
+	var control *node
+	switch el.kind {
+	case "calculate", "hidden", "start", "end", "today", "deviceid", "username", "phonenumber", "email":
+		return nil
+	case "background-audio":
+		s.actions = append(s.actions, newNode("odk:recordaudio", "event", "odk-instance-load", "ref", el.path))
+		return nil
+	case "image", "audio", "video", "file":
+		control = newNode("upload", "mediatype", uploadMediaTypes[el.kind], "ref", el.path)
+	case "acknowledge":
+		control = newNode("trigger", "ref", el.path)
+	case "select_one", "select_one_from_file":
+		control = newNode("select1", "ref", el.path)
+	case "select_multiple", "select_multiple_from_file":
+		control = newNode("select", "ref", el.path)
+	case "rank":
+		control = newNode("odk:rank", "ref", el.path)
+	default:
+		control = newNode("input", "ref", el.path)
+	}
+	if appearance, ok := el.columns["appearance"]; ok {
+		control.setAttr("appearance", appearance)
+	}
+	s.addLabelAndHint(el, control)
+	if err := s.addChoices(el, control); err != nil {
+		return err
+	}
+	body.add(control)
+	return nil
+}
+
+func (s *encodeState) encodeGroup(el *element, instance, body *node) error {
+	groupInstance := newNode(el.name)
+	bind := newNode("bind", "nodeset", el.path)
+	if err := s.addBindExprs(el, bind); err != nil {
+		return err
+	}
+	if len(bind.attrs) > 1 {
+		s.binds = append(s.binds, bind)
+	}
+	group := newNode("group", "ref", el.path)
+	if appearance, ok := el.columns["appearance"]; ok {
+		group.setAttr("appearance", appearance)
+	}
+	s.addLabelAndHint(el, group)
+	container := group
+	if el.kind == "begin_repeat" {
+		container = newNode("repeat", "nodeset", el.path)
+		if count, ok := el.columns["repeat_count"]; ok {
+			countRef, err := s.repeatCount(el, count, instance)
+			if err != nil {
+				return err
+			}
+			container.setAttr("jr:count", countRef)
+		}
+		group.add(container)
+	}
+	for _, child := range el.children {
+		if err := s.encodeElement(child, groupInstance, container); err != nil {
+			return err
+		}
+	}
+	if el.kind == "begin_repeat" {
+		template := newNode(el.name, "jr:template", "")
+		template.children = groupInstance.children
+		instance.add(template)
+	}
+	instance.add(groupInstance)
+	body.add(group)
+	return nil
+}
+
+// repeatCount returns the jr:count of a repeat. Expressions other than a number or a single
+// reference are computed in a calculate node next to the repeat the same way pyxform does
+func (s *encodeState) repeatCount(el *element, count string, instance *node) (string, error) {
+	if _, err := strconv.Atoi(count); err == nil {
+		return count, nil
+	}
+	expr, err := s.expr(count)
+	if err != nil {
+		return "", err
+	}
+	if refRe.MatchString(count) && refRe.FindString(count) == strings.TrimSpace(count) {
+		return expr, nil
+	}
+	countPath := el.path + "_count"
+	instance.add(newNode(el.name + "_count"))
+	s.binds = append(s.binds, newNode("bind", "calculate", expr, "nodeset", countPath, "readonly", "true()", "type", "string"))
+	return countPath, nil
+}
+
+func (s *encodeState) addBindExprs(el *element, bind *node) error {
+	exprAttrs := [][2]string{{"relevant", "relevant"}, {"constraint", "constraint"}, {"calculation", "calculate"}}
+	for _, a := range exprAttrs {
+		if val, ok := el.columns[a[0]]; ok {
+			e, err := s.expr(val)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", el.name, a[0], err)
+			}
+			bind.setAttr(a[1], e)
+		}
+	}
+	if required, ok := el.columns["required"]; ok {
+		switch strings.ToLower(required) {
+		case "yes", "true", "true()":
+			bind.setAttr("required", "true()")
+		case "no", "false", "false()", "":
+		default:
+			e, err := s.expr(required)
+			if err != nil {
+				return fmt.Errorf("%s required: %w", el.name, err)
+			}
+			bind.setAttr("required", e)
+		}
+	}
+	if readOnly, ok := el.columns["read_only"]; ok {
+		switch strings.ToLower(readOnly) {
+		case "yes", "true", "true()":
+			bind.setAttr("readonly", "true()")
+		case "no", "false", "false()", "":
+		default:
+			e, err := s.expr(readOnly)
+			if err != nil {
+				return fmt.Errorf("%s read_only: %w", el.name, err)
+			}
+			bind.setAttr("readonly", e)
+		}
+	}
+	if texts, ok := el.translations["constraint_message"]; ok {
+		bind.setAttr("jr:constraintMsg", s.addText(el.path+":jr:constraintMsg", texts))
+	}
+	if texts, ok := el.translations["required_message"]; ok {
+		bind.setAttr("jr:requiredMsg", s.addText(el.path+":jr:requiredMsg", texts))
+	}
+	return nil
+}
+
+func (s *encodeState) addLabelAndHint(el *element, control *node) {
+	if texts, ok := el.translations["label"]; ok || el.media != nil {
+		control.add(newNode("label", "ref", s.addMediaText(el.path+":label", texts, el.media)))
+	}
+	if texts, ok := el.translations["hint"]; ok {
+		control.add(newNode("hint", "ref", s.addText(el.path+":hint", texts)))
+	}
+}
+
+// addChoices adds the choice items of a select control. Lists that are filtered or loaded from a
+// file are written as secondary instances and referenced through an itemset
+func (s *encodeState) addChoices(el *element, control *node) error {
+	if !strings.HasPrefix(el.kind, "select_") && el.kind != "rank" {
+		return nil
+	}
+	if el.choices == nil {
+		return fmt.Errorf("%s %q has no choices", el.name, el.kind)
+	}
+	list := el.choices
+	filter, hasFilter := el.columns["choice_filter"]
+	if filter != "" {
+		var err error
+		filter, err = s.expr(filter)
+		if err != nil {
+			return fmt.Errorf("%s choice_filter: %w", el.name, err)
+		}
+		filter = fmt.Sprintf("[%s]", filter)
+	}
+	switch {
+	case strings.HasSuffix(el.kind, "_from_file"), list.fromFile, el.kind == "select_one_external":
+		if _, ok := s.instances[list.name]; !ok {
+			s.instances[list.name] = newNode("instance", "id", list.name, "src", fmt.Sprintf("jr://file-csv/%s.csv", list.name))
+			s.instanceIds = append(s.instanceIds, list.name)
+		}
+		nodeset := fmt.Sprintf("instance('%s')/root/item%s", list.name, filter)
+		if el.kind == "select_one_external" {
+			control.name = "input"
+			control.setAttr("query", nodeset)
+			return nil
+		}
+		control.add(newNode("itemset", "nodeset", nodeset).add(newNode("value", "ref", "name"), newNode("label", "ref", "label")))
+	case hasFilter || el.kind == "rank":
+		if _, ok := s.instances[list.name]; !ok {
+			root := newNode("root")
+			for i, item := range list.items {
+				id := fmt.Sprintf("%s-%d", list.name, i)
+				s.addMediaText(id, item.labels, item.media)
+				itemNode := newNode("item").add(newNode("itextId").setText(id), newNode("name").setText(item.name))
+				for _, key := range sortedKeys(item.extra) {
+					itemNode.add(newNode(key).setText(item.extra[key]))
+				}
+				root.add(itemNode)
+			}
+			s.instances[list.name] = newNode("instance", "id", list.name).add(root)
+			s.instanceIds = append(s.instanceIds, list.name)
+		}
+		nodeset := fmt.Sprintf("instance('%s')/root/item%s", list.name, filter)
+		control.add(newNode("itemset", "nodeset", nodeset).add(newNode("value", "ref", "name"), newNode("label", "ref", "jr:itext(itextId)")))
+	default:
+		for i, item := range list.items {
+			id := fmt.Sprintf("%s-%d", list.name, i)
+			control.add(newNode("item").add(newNode("label", "ref", s.addMediaText(id, item.labels, item.media)), newNode("value").setText(item.name)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package xform
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		file string
+		want string
+		err  error
+	}{
+		{
+			file: "testdata/form.cue",
+			want: "testdata/form.xml",
+		},
+		{
+			file: "testdata/media.cue",
+			want: "testdata/media.xml",
+		},
+		{
+			file: "testdata/unknown_ref.cue",
+			err:  ErrUnknownReference,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			encoder := NewEncoder()
+			b, err := encoder.Encode(tc.file)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %s but wanted %s", err, tc.err)
+			}
+			if tc.want == "" {
+				return
+			}
+			want, err := os.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := b.String(); have != string(want) {
+				t.Fatalf("have\n%s\nwant\n%s", have, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+#Settings: {...}
+
+family_name: #Question & {
+	type: "text"
+	name: "family_name"
+	label: {
+		"English (en)":   "What's your family name?"
+		"Afrikaans (af)": "Wat is jou familienaam?"
+	}
+	required: "yes"
+	required_message: "English (en)": "We need a family name"
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	appearance: "field-list"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is your father?"
+			constraint: ". > 18"
+			constraint_message: "English (en)": "Too young to be a father"
+		},
+		#Question & {
+			type: "select_one"
+			choices: #Choices & {
+				list_name: "yes_no"
+				choices: [
+					{
+						yes: "English (en)": "Yes"
+					},
+					{
+						no: "English (en)": "No"
+					},
+				]
+			}
+			name: "is_home"
+			label: "English (en)": "Is he home?"
+			relevant: "${age} > 40"
+		},
+	]
+}
+child: #Group & {
+	type:         "begin_repeat"
+	name:         "child"
+	label: "English (en)": "Child"
+	repeat_count: "${age} div 10"
+	children: [
+		#Question & {
+			type: "text"
+			name: "child_name"
+			label: "English (en)": "Name"
+			hint: "English (en)": "First name of ${family_name}'s child"
+		},
+	]
+}
+form_settings: #Settings & {
+	type:             "settings"
+	form_title:       "test"
+	form_id:          "test_id"
+	version:          "1"
+	default_language: "English (en)"
+	instance_name:    "concat(${family_name}, '-', ${age})"
+}
@@ -0,0 +1,10 @@
+package main
+
+#Question: {...}
+
+age: #Question & {
+	type: "integer"
+	name: "age"
+	label: "English (en)": "How old are you?"
+	relevant: "${consent} = 'yes'"
+}
@@ -0,0 +1,205 @@
+package xform
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+var (
+	// nsPrefixes maps the namespaces used in xforms to the prefixes we refer to them by, elements
+	// in the default xforms namespace have no prefix
+	nsPrefixes = map[string]string{
+		"http://www.w3.org/2002/xforms":     "",
+		"http://www.w3.org/1999/xhtml":      "h",
+		"http://openrosa.org/javarosa":      "jr",
+		"http://www.opendatakit.org/xforms": "odk",
+		"http://openrosa.org/xforms":        "orx",
+		"http://www.w3.org/2001/XMLSchema":  "xsd",
+		"http://www.w3.org/2001/xml-events": "ev",
+	}
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#10;")
+)
+
+// node is a minimal XML element. We build the XForm document by hand so that the
+// namespace prefixes ODK tooling expects (h:, jr:, odk:) are kept exactly as written
+type node struct {
+	name  string
+	attrs []attr
+	text  string
+	// raw is written out as is, it holds mixed content like <output/> tags inside itext values
+	raw      string
+	children []*node
+}
+
+type attr struct {
+	name  string
+	value string
+}
+
+// newNode returns an element with the given attributes, attrs is a list of name, value pairs
+func newNode(name string, attrs ...string) *node {
+	n := &node{name: name}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.setAttr(attrs[i], attrs[i+1])
+	}
+	return n
+}
+
+func (n *node) setAttr(name, value string) *node {
+	for i := range n.attrs {
+		if n.attrs[i].name == name {
+			n.attrs[i].value = value
+			return n
+		}
+	}
+	n.attrs = append(n.attrs, attr{name: name, value: value})
+	return n
+}
+
+func (n *node) getAttr(name string) string {
+	for _, a := range n.attrs {
+		if a.name == name {
+			return a.value
+		}
+	}
+	return ""
+}
+
+func (n *node) add(children ...*node) *node {
+	n.children = append(n.children, children...)
+	return n
+}
+
+func (n *node) setText(text string) *node {
+	n.text = text
+	return n
+}
+
+func (n *node) setRaw(raw string) *node {
+	n.raw = raw
+	return n
+}
+
+// child returns the first direct child with the given name
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseXML reads an XML document into a node tree. Names are prefixed the same way we write them
+// and <output/> tags in mixed content are turned back into ${name} references in the parent text
+func parseXML(r io.Reader) (*node, error) {
+	decoder := xml.NewDecoder(r)
+	stack := []*node{}
+	var root *node
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: prefixedName(t.Name)}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs = append(n.attrs, attr{name: prefixedName(a.Name), value: a.Value})
+			}
+			if len(stack) == 0 {
+				root = n
+			} else if parent := stack[len(stack)-1]; n.name == "output" {
+				parent.text += pathToRef(n.getAttr("value"))
+			} else {
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	root.trim()
+	return root, nil
+}
+
+func prefixedName(name xml.Name) string {
+	prefix, ok := nsPrefixes[name.Space]
+	if !ok {
+		prefix = name.Space
+	}
+	if prefix == "" {
+		return name.Local
+	}
+	return prefix + ":" + name.Local
+}
+
+// trim drops the whitespace used to indent elements that have children
+func (n *node) trim() {
+	if len(n.children) > 0 {
+		n.text = strings.TrimSpace(n.text)
+	}
+	for _, c := range n.children {
+		c.trim()
+	}
+}
+
+func (n *node) write(b *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent)
+	b.WriteString("<")
+	b.WriteString(n.name)
+	for _, a := range n.attrs {
+		b.WriteString(" ")
+		b.WriteString(a.name)
+		b.WriteString(`="`)
+		attrEscaper.WriteString(b, a.value)
+		b.WriteString(`"`)
+	}
+	switch {
+	case n.raw != "":
+		b.WriteString(">")
+		b.WriteString(n.raw)
+		b.WriteString("</")
+		b.WriteString(n.name)
+		b.WriteString(">\n")
+	case len(n.children) == 0 && n.text == "":
+		b.WriteString("/>\n")
+	case len(n.children) == 0:
+		b.WriteString(">")
+		textEscaper.WriteString(b, n.text)
+		b.WriteString("</")
+		b.WriteString(n.name)
+		b.WriteString(">\n")
+	default:
+		b.WriteString(">\n")
+		if n.text != "" {
+			b.WriteString(indent + "  ")
+			textEscaper.WriteString(b, n.text)
+			b.WriteString("\n")
+		}
+		for _, c := range n.children {
+			c.write(b, depth+1)
+		}
+		b.WriteString(indent)
+		b.WriteString("</")
+		b.WriteString(n.name)
+		b.WriteString(">\n")
+	}
+}
@@ -0,0 +1,120 @@
+package xlsform
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// EncodeCSV returns the XLSForm equivalent of the CUE file at filePath as a bundle of CSV files,
+// one per sheet, keyed by their file name e.g. survey.csv. Attachments of choice lists loaded from
+// a file are part of the bundle
+func (encoder *Encoder) EncodeCSV(filePath string) (map[string][]byte, error) {
+	xlsform, err := encoder.toXLSForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return xlsform.writeCSV()
+}
+
+// DecodeDir returns the CUE encoding of the CSV bundle in dir. The bundle is made up of a survey.csv
+// and optionally a choices.csv, external_choices.csv, entities.csv and settings.csv. Attachments of
+// choice lists loaded from a file are read from dir too unless we have been given another directory
+func (d *Decoder) DecodeDir(dir string) ([]byte, error) {
+	sheets, err := readCSVDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	form, err := d.parseSheets(sheets)
+	if err != nil {
+		return nil, err
+	}
+	if d.attachmentDir == "" {
+		if err := form.loadAttachments(dir); err != nil {
+			return nil, err
+		}
+	}
+	return d.decodeForm(form)
+}
+
+// readCSVDir reads the rows of the sheets of the CSV bundle in dir
+func readCSVDir(dir string) (map[string][][]string, error) {
+	sheets := map[string][][]string{}
+	for _, sheet := range xlsFormSheets {
+		rows, err := readCSV(filepath.Join(dir, fmt.Sprintf("%s.csv", sheet)))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// missing sheets are checked by parseSheets
+				continue
+			}
+			return nil, err
+		}
+		sheets[sheet] = rows
+	}
+	return sheets, nil
+}
+
+// readCSV reads all the rows of a CSV file. Trailing empty cells are dropped so that rows look the
+// same as the ones we get from a spreadsheet
+func readCSV(file string) ([][]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %w", file, err, ErrInvalidXLSForm)
+	}
+	for i, row := range rows {
+		end := len(row)
+		for end > 0 && row[end-1] == "" {
+			end--
+		}
+		rows[i] = row[:end]
+	}
+	return rows, nil
+}
+
+// writeCSV writes each sheet of the form to a CSV file
+func (form *xlsForm) writeCSV() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	sheets := []struct {
+		name    string
+		headers []string
+		rows    [][]string
+	}{
+		{surveySheetName, form.surveyColumnHeaders, form.survey},
+		{choiceSheetName, form.choiceColumnHeaders, form.choices},
+		{externalChoiceSheetName, form.externalChoiceColumnHeaders, form.externalChoices},
+		{entitiesSheetName, form.entityColumnHeaders, form.entities},
+		{settingsSheetName, form.settingColumnHeaders, form.settings},
+	}
+	for _, sheet := range sheets {
+		if sheet.name != surveySheetName && len(sheet.rows) == 0 {
+			continue
+		}
+		b := &bytes.Buffer{}
+		w := csv.NewWriter(b)
+		if err := w.Write(sheet.headers); err != nil {
+			return nil, err
+		}
+		if err := w.WriteAll(sheet.rows); err != nil {
+			return nil, err
+		}
+		files[fmt.Sprintf("%s.csv", sheet.name)] = b.Bytes()
+	}
+	for name, b := range form.attachments {
+		if _, exists := files[name]; exists {
+			return nil, fmt.Errorf("attachment %s has the same name as a sheet: %w", name, ErrInvalidXLSForm)
+		}
+		files[name] = b
+	}
+	return files, nil
+}
@@ -0,0 +1,70 @@
+package xlsform
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCSVBundle(t *testing.T) {
+	testCases := []struct {
+		file string
+		err  error
+		form *xlsForm
+	}{
+		{
+			file: "testdata/form_select.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)"},
+				survey: [][]string{
+					{"text", "family_name", "What's your family name?"},
+					{"begin_group", "father", "Father"},
+					{"select_one ages", "age", "How old is your father?"},
+					{"end_group"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)"},
+				choices: [][]string{
+					{"ages", "over_30", "Over 30"},
+					{"ages", "over_40", "Over 40"},
+				},
+				settingColumnHeaders: []string{"form_title", "form_id", "default_language", "version"},
+				settings: [][]string{
+					{"test", "test_id", "English (en)", "1"},
+				},
+			},
+		},
+		{
+			file: "",
+			err:  ErrInvalidXLSForm,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.file != "" {
+				files, err := NewEncoder().EncodeCSV(tc.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for name, b := range files {
+					if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			sheets, err := readCSVDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			form, err := parseSheets(sheets)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %s but wanted %s", err, tc.err)
+			}
+			if !reflect.DeepEqual(form, tc.form) {
+				t.Fatalf("have\n%+v\nbut want\n%+v", form, tc.form)
+			}
+		})
+	}
+}
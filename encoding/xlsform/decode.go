@@ -2,13 +2,19 @@ package xlsform
 
 import (
 	"bytes"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/ast/astutil"
 	"cuelang.org/go/cue/format"
@@ -20,17 +26,37 @@ var (
 	ErrInvalidXLSForm      = errors.New("xlsform structure is incorrect")
 	ErrInvalidXLSFormSheet = errors.New("found xlsform sheet missing a required column")
 	ErrInvalidLabel        = errors.New("found translatable column with no language code")
+	ErrInvalidMedia        = errors.New("found media column with an unknown media type")
+	ErrMissingValue        = errors.New("found row missing a required value")
+	ErrUnbalancedGroup     = errors.New("found group or repeat that is not closed properly")
+	ErrUnknownChoiceList   = errors.New("found select question with an unknown choice list")
+	ErrConflictingChoices  = errors.New("found choice lists with the same list_name but different choices")
 
-	surveySheetName   = "survey"
-	choiceSheetName   = "choices"
-	settingsSheetName = "settings"
+	surveySheetName         = "survey"
+	choiceSheetName         = "choices"
+	externalChoiceSheetName = "external_choices"
+	entitiesSheetName       = "entities"
+	settingsSheetName       = "settings"
+	// xlsFormSheets are the sheets we read, the others are ignored
+	xlsFormSheets = []string{surveySheetName, choiceSheetName, externalChoiceSheetName, entitiesSheetName, settingsSheetName}
 
 	requiredSurveySheetColumns = []string{"type", "name", "label"}
 	requiredChoiceSheetColumns = []string{"list_name", "name", "label"}
+	requiredEntitySheetColumns = []string{"list_name", "label"}
+
+	// typedColumns are the survey columns the schema gives a type other than string
+	typedColumns = map[string]cue.Kind{
+		"required":     cue.BoolKind,
+		"read_only":    cue.BoolKind,
+		"repeat_count": cue.IntKind,
+	}
 )
 
 type Decoder struct {
-	schemaPkg string
+	schemaPkg     string
+	attachmentDir string
+	typedValues   bool
+	defaultLang   string
 }
 
 // NewDecoder returns a new decoder that uses pkg as the xlsform schema definition package
@@ -44,12 +70,93 @@ func (d *Decoder) UsePkg(schemaPkg string) {
 	d.schemaPkg = schemaPkg
 }
 
-// Decode returns the CUE encoding of r
+// UseAttachmentDir sets the directory we look for the csv files of select_one_from_file and
+// select_multiple_from_file questions in, usually the one the form is in
+func (d *Decoder) UseAttachmentDir(dir string) {
+	d.attachmentDir = dir
+}
+
+// UseTypedValues makes the decoder infer bools and numbers for the typed survey columns e.g
+// required: yes becomes required: true, otherwise every value is decoded as a string
+func (d *Decoder) UseTypedValues(typed bool) {
+	d.typedValues = typed
+}
+
+// UseDefaultLang makes the decoder read the translatable columns that have no language e.g a
+// plain label or hint column as lang, otherwise they are an error
+func (d *Decoder) UseDefaultLang(lang string) {
+	d.defaultLang = lang
+}
+
+// Decode returns the CUE encoding of r. The rows of the choices and external_choices sheets are
+// converted as they are read so that sheets with a lot of choices don't have to fit in memory
 func (d *Decoder) Decode(r io.Reader) ([]byte, error) {
-	form, err := parseXLSForm(r)
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	form, err := d.streamXLSX(f)
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeForm(form)
+}
+
+// DecodeCueForm decodes r and loads the CUE it decodes to. The CUE is written to a temporary
+// directory to be loaded so the schema package it imports has to resolve from the working directory
+func (d *Decoder) DecodeCueForm(r io.Reader) (*CueForm, error) {
+	source, err := d.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	// a directory of its own so that no labels.cue is picked up along with the form
+	dir, err := os.MkdirTemp("", "cueform")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "form.cue")
+	if err := os.WriteFile(file, source, 0o644); err != nil {
+		return nil, err
+	}
+	return ParseCueForm(file)
+}
+
+// DecodeSheets returns the CUE encoding of an XLSForm whose sheets have already been read into rows.
+// sheets maps the sheet name to its rows, the first row of each sheet holds the column headers
+func (d *Decoder) DecodeSheets(sheets map[string][][]string) ([]byte, error) {
+	form, err := d.parseSheets(sheets)
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeForm(form)
+}
+
+// parseSheets is parseSheets with the untranslated columns given the decoder's default language
+func (d *Decoder) parseSheets(sheets map[string][][]string) (*xlsForm, error) {
+	if d.defaultLang == "" {
+		return parseSheets(sheets)
+	}
+	form, err := parseSheets(translateSheets(sheets, d.defaultLang))
 	if err != nil {
 		return nil, err
 	}
+	form.defaultLang = d.defaultLang
+	return form, nil
+}
+
+func (d *Decoder) decodeForm(form *xlsForm) ([]byte, error) {
+	if d.attachmentDir != "" {
+		if err := form.loadAttachments(d.attachmentDir); err != nil {
+			return nil, err
+		}
+	}
+	form.typedValues = d.typedValues
 	file, err := form.toAstFile(ast.NewImport(nil, d.schemaPkg))
 	if err != nil {
 		return nil, err
@@ -64,13 +171,38 @@ type xlsForm struct {
 	// contains all rows in the choices sheet
 	choiceColumnHeaders []string
 	choices             [][]string
+	// contains all rows in the external_choices sheet
+	externalChoiceColumnHeaders []string
+	externalChoices             [][]string
+	// contains all rows in the entities sheet
+	entityColumnHeaders []string
+	entities            [][]string
+	// csv files of the choice lists that are loaded from a file, keyed by file name
+	attachments map[string][]byte
 	// contains all rows in the settings sheet
 	settingColumnHeaders []string
 	settings             [][]string
+	// infer the types of the typed survey columns instead of decoding them as strings
+	typedValues bool
+	// the language of the untranslated columns
+	defaultLang string
+	// choice lists that were built while the choices and external_choices sheets were read, the
+	// rows of those sheets are not kept when they are set
+	choiceLists         *choiceLists
+	externalChoiceLists *choiceLists
 }
 
 // parseXLSForm parses the xls file into an XLSForm struct
 func parseXLSForm(r io.Reader) (*xlsForm, error) {
+	sheets, err := readXLSXSheets(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseSheets(sheets)
+}
+
+// readXLSXSheets reads the rows of the xlsform sheets in the xls file
+func readXLSXSheets(r io.Reader) (map[string][][]string, error) {
 	f, err := excelize.OpenReader(r)
 	if err != nil {
 		return nil, err
@@ -80,87 +212,232 @@ func parseXLSForm(r io.Reader) (*xlsForm, error) {
 			log.Println(err)
 		}
 	}()
-	form := xlsForm{}
-	if surveyRows, err := f.GetRows(surveySheetName); err != nil {
-		return nil, fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)
-	} else {
-		if err := validXLSFormSheet(surveySheetName, surveyRows); err != nil {
+	sheets := map[string][][]string{}
+	for _, sheet := range xlsFormSheets {
+		rows, err := openRows(f, sheet)
+		if err != nil {
 			return nil, err
 		}
-		form.surveyColumnHeaders = surveyRows[0]
-		if len(surveyRows) > 1 {
-			form.survey = surveyRows[1:]
+		if rows == nil {
+			continue
 		}
-	}
-	if choiceRows, err := f.GetRows(choiceSheetName); err != nil {
-		if !errors.Is(err, excelize.ErrSheetNotExist{SheetName: choiceSheetName}) {
+		if sheets[sheet], err = readRows(rows); err != nil {
 			return nil, err
 		}
-		// choices is not required
-		log.Println(err)
+	}
+	return sheets, nil
+}
 
-	} else {
-		if err := validXLSFormSheet(choiceSheetName, choiceRows); err != nil {
+// streamXLSX reads the xls file into an XLSForm struct. Only the header rows of the choice sheets
+// are read before the sheets are checked, the rest go to their choice lists as they are read
+func (d *Decoder) streamXLSX(f *excelize.File) (*xlsForm, error) {
+	sheets := map[string][][]string{}
+	choiceRows := map[string]*excelize.Rows{}
+	defer func() {
+		for _, rows := range choiceRows {
+			if err := rows.Close(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+	for _, sheet := range xlsFormSheets {
+		rows, err := openRows(f, sheet)
+		if err != nil {
+			return nil, err
+		}
+		if rows == nil {
+			continue
+		}
+		if sheet != choiceSheetName && sheet != externalChoiceSheetName {
+			if sheets[sheet], err = readRows(rows); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		choiceRows[sheet] = rows
+		sheets[sheet] = [][]string{}
+		if rows.Next() {
+			header, err := rows.Columns()
+			if err != nil {
+				return nil, err
+			}
+			sheets[sheet] = [][]string{header}
+		}
+	}
+	form, err := d.parseSheets(sheets)
+	if err != nil {
+		return nil, err
+	}
+	if rows, ok := choiceRows[choiceSheetName]; ok {
+		if form.choiceLists, err = streamChoiceLists(rows, form.choiceColumnHeaders); err != nil {
 			return nil, err
 		}
-		form.choiceColumnHeaders = choiceRows[0]
-		if len(choiceRows) > 1 {
-			form.choices = choiceRows[1:]
+	}
+	if rows, ok := choiceRows[externalChoiceSheetName]; ok {
+		if form.externalChoiceLists, err = streamChoiceLists(rows, form.externalChoiceColumnHeaders); err != nil {
+			return nil, err
 		}
 	}
-	if settingsRows, err := f.GetRows(settingsSheetName); err != nil {
-		if !errors.Is(err, excelize.ErrSheetNotExist{SheetName: settingsSheetName}) {
+	return form, nil
+}
+
+// openRows returns an iterator over the rows of sheet or nil if an optional sheet is missing
+func openRows(f *excelize.File, sheet string) (*excelize.Rows, error) {
+	rows, err := f.Rows(sheet)
+	if err == nil {
+		return rows, nil
+	}
+	if sheet == surveySheetName {
+		return nil, DecodeErrors{{Sheet: sheet, Err: fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)}}
+	}
+	if !errors.Is(err, excelize.ErrSheetNotExist{SheetName: sheet}) {
+		return nil, err
+	}
+	// only the survey sheet is required
+	return nil, nil
+}
+
+// readRows reads the rest of the rows, leaving out the empty ones at the end the way
+// excelize.GetRows does
+func readRows(rows *excelize.Rows) ([][]string, error) {
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	result := [][]string{}
+	last := 0
+	for rows.Next() {
+		row, err := rows.Columns()
+		if err != nil {
 			return nil, err
 		}
-		// settings is not required
-		log.Println(err)
-	} else {
-		if err := validXLSFormSheet(settingsSheetName, settingsRows); err != nil {
+		result = append(result, row)
+		if len(row) > 0 {
+			last = len(result)
+		}
+	}
+	return result[:last], rows.Error()
+}
+
+// streamChoiceLists adds the rest of the rows of a choice sheet to its choice lists
+func streamChoiceLists(rows *excelize.Rows, columns []string) (*choiceLists, error) {
+	lists := newChoiceLists(columns)
+	// the header is row 1
+	for rowNum := 2; rows.Next(); rowNum++ {
+		row, err := rows.Columns()
+		if err != nil {
 			return nil, err
 		}
-		form.settingColumnHeaders = settingsRows[0]
-		if len(settingsRows) > 1 {
-			form.settings = settingsRows[1:]
+		lists.add(rowNum, row)
+	}
+	return lists, rows.Error()
+}
+
+// parseSheets validates the rows of each sheet and builds an XLSForm struct from them. Every sheet
+// is checked before we return so that all the problems with the headers are reported at once
+func parseSheets(sheets map[string][][]string) (*xlsForm, error) {
+	form := xlsForm{}
+	surveyRows, ok := sheets[surveySheetName]
+	if !ok {
+		return nil, DecodeErrors{{Sheet: surveySheetName, Err: fmt.Errorf("missing sheet: %w", ErrInvalidXLSForm)}}
+	}
+	errs := validXLSFormSheet(surveySheetName, surveyRows)
+	if len(errs) == 0 {
+		form.surveyColumnHeaders = surveyRows[0]
+		if len(surveyRows) > 1 {
+			form.survey = surveyRows[1:]
+		}
+	}
+	if choiceRows, ok := sheets[choiceSheetName]; ok {
+		if sheetErrs := validXLSFormSheet(choiceSheetName, choiceRows); len(sheetErrs) > 0 {
+			errs = append(errs, sheetErrs...)
+		} else {
+			form.choiceColumnHeaders = choiceRows[0]
+			if len(choiceRows) > 1 {
+				form.choices = choiceRows[1:]
+			}
+		}
+	}
+	if externalChoiceRows, ok := sheets[externalChoiceSheetName]; ok {
+		if sheetErrs := validXLSFormSheet(externalChoiceSheetName, externalChoiceRows); len(sheetErrs) > 0 {
+			errs = append(errs, sheetErrs...)
+		} else {
+			form.externalChoiceColumnHeaders = externalChoiceRows[0]
+			if len(externalChoiceRows) > 1 {
+				form.externalChoices = externalChoiceRows[1:]
+			}
+		}
+	}
+	if entityRows, ok := sheets[entitiesSheetName]; ok {
+		if sheetErrs := validXLSFormSheet(entitiesSheetName, entityRows); len(sheetErrs) > 0 {
+			errs = append(errs, sheetErrs...)
+		} else {
+			form.entityColumnHeaders = entityRows[0]
+			if len(entityRows) > 1 {
+				form.entities = entityRows[1:]
+			}
+		}
+	}
+	if settingsRows, ok := sheets[settingsSheetName]; ok {
+		if sheetErrs := validXLSFormSheet(settingsSheetName, settingsRows); len(sheetErrs) > 0 {
+			errs = append(errs, sheetErrs...)
+		} else {
+			form.settingColumnHeaders = settingsRows[0]
+			if len(settingsRows) > 1 {
+				form.settings = settingsRows[1:]
+			}
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return &form, nil
 }
 
-// validXLSFormSheet validates that the work sheet has the required columns
-func validXLSFormSheet(sheet string, rows [][]string) error {
+// validXLSFormSheet validates that the work sheet has the required columns and that we can tell
+// the language and media type of its translatable and media columns
+func validXLSFormSheet(sheet string, rows [][]string) DecodeErrors {
+	errs := DecodeErrors{}
 	if len(rows) <= 0 {
-		log.Printf("%s is empty", sheet)
-		return ErrInvalidXLSForm
+		errs.add(sheet, 0, "", "", fmt.Errorf("empty sheet: %w", ErrInvalidXLSForm))
+		return errs
 	}
 	columnHeaders := rows[0]
-	if sheet == surveySheetName {
-		for _, requiredCol := range requiredSurveySheetColumns {
+	switch sheet {
+	case surveySheetName, choiceSheetName, externalChoiceSheetName:
+		requiredColumns := requiredSurveySheetColumns
+		if sheet != surveySheetName {
+			requiredColumns = requiredChoiceSheetColumns
+		}
+		for _, requiredCol := range requiredColumns {
 			match := slices.ContainsFunc(columnHeaders, func(s string) bool {
-				_, found := strings.CutPrefix(s, requiredCol)
-				if !found {
-					log.Println("no match", s, requiredCol)
-				}
-				return found
+				return strings.HasPrefix(s, requiredCol)
 			})
 			if !match {
-				return ErrInvalidXLSFormSheet
+				errs.add(sheet, 1, requiredCol, "", ErrInvalidXLSFormSheet)
 			}
 		}
-	} else if sheet == choiceSheetName {
-		for _, requiredCol := range requiredChoiceSheetColumns {
-			match := slices.ContainsFunc(columnHeaders, func(s string) bool {
-				_, found := strings.CutPrefix(s, requiredCol)
-				if !found {
-					log.Println("no match", s, requiredCol)
+		for _, header := range columnHeaders {
+			if IsMediaColumn(header) {
+				if _, _, err := GetMediaFromCol(header); err != nil {
+					errs.add(sheet, 1, header, "", ErrInvalidMedia)
 				}
-				return found
-			})
-			if !match {
-				return ErrInvalidXLSFormSheet
+			} else if sheet == surveySheetName && IsTranslatableColumn(header) || sheet != surveySheetName && header == "label" {
+				// the other label like columns of the choice sheets are kept as custom columns
+				if _, _, err := GetLangFromCol(header); err != nil {
+					errs.add(sheet, 1, header, "", ErrInvalidLabel)
+				}
+			}
+		}
+	case entitiesSheetName:
+		for _, requiredCol := range requiredEntitySheetColumns {
+			if !slices.Contains(columnHeaders, requiredCol) {
+				errs.add(sheet, 1, requiredCol, "", ErrInvalidXLSFormSheet)
 			}
 		}
 	}
-	return nil
+	return errs
 }
 
 func (form *xlsForm) toAstFile(i *ast.ImportSpec) (*ast.File, error) {
@@ -168,10 +445,19 @@ func (form *xlsForm) toAstFile(i *ast.ImportSpec) (*ast.File, error) {
 	if err != nil {
 		return nil, err
 	}
+	errs := DecodeErrors{}
 	choiceMap, err := form.choicesToAst(importInfo)
-	if err != nil {
+	if err = errs.collect(err); err != nil {
 		return nil, err
 	}
+	errs = append(errs, form.checkSurvey(choiceMap)...)
+	entities, err := form.entitiesToAst(importInfo)
+	if err = errs.collect(err); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	root := ast.NewStruct()
 	_, err = form.surveyToAst(importInfo, root, 0, choiceMap)
 	if err != nil {
@@ -196,6 +482,17 @@ func (form *xlsForm) toAstFile(i *ast.ImportSpec) (*ast.File, error) {
 		nameValue := nameField.Value.(*ast.BasicLit)
 		decls = append(decls, &ast.Field{Label: nameValue, Value: v})
 	}
+	// every choice list is declared once after the survey and the questions refer to it
+	lists, err := nameChoiceLists(&ast.File{Decls: decls})
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range lists {
+		decls = append(decls, list)
+	}
+	if entities != nil {
+		decls = append(decls, entities)
+	}
 	settings := form.settingsToAst(importInfo)
 	if settings != nil {
 		decls = append(decls, settings)
@@ -203,67 +500,263 @@ func (form *xlsForm) toAstFile(i *ast.ImportSpec) (*ast.File, error) {
 	return &ast.File{Decls: decls}, nil
 }
 
-// choicesToAst converts rows from the choice sheet to CUE expressions
+// choicesToAst converts rows from the choices and external_choices sheets and the attachments of file
+// backed lists to CUE expressions
 func (form *xlsForm) choicesToAst(importInfo astutil.ImportInfo) (map[string]ast.Expr, error) {
-	if len(form.choices) == 0 {
-		return nil, nil
-	}
+	errs := DecodeErrors{}
 	choiceAsts := make(map[string]ast.Expr)
-	for choiceKey, rows := range extractChoices(form.choiceColumnHeaders, form.choices) {
-		choiceStruct, err := buildChoiceStruct(choiceKey, form.choiceColumnHeaders, rows)
-		if err != nil {
-			return nil, err
+	choices := form.choiceLists
+	if choices == nil {
+		choices = rowChoiceLists(form.choiceColumnHeaders, form.choices)
+	}
+	for _, choiceKey := range choices.order {
+		if err := choices.errs[choiceKey]; err != nil {
+			errs.add(choiceSheetName, choices.errRows[choiceKey], "list_name", choiceKey, err)
+			continue
+		}
+		choiceAsts[choiceKey] = newConjuctionOnNewLine(importInfo, "Choices", choices.lists[choiceKey], false)
+	}
+	externalChoices := form.externalChoiceLists
+	if externalChoices == nil {
+		externalChoices = rowChoiceLists(form.externalChoiceColumnHeaders, form.externalChoices)
+	}
+	for _, choiceKey := range externalChoices.order {
+		if _, exists := choiceAsts[choiceKey]; exists {
+			errs.add(externalChoiceSheetName, externalChoices.rows[choiceKey], "list_name", choiceKey, fmt.Errorf("also in the %s sheet: %w", choiceSheetName, ErrInvalidXLSForm))
+			continue
+		}
+		if err := externalChoices.errs[choiceKey]; err != nil {
+			errs.add(externalChoiceSheetName, externalChoices.errRows[choiceKey], "list_name", choiceKey, err)
+			continue
 		}
+		choiceStruct := externalChoices.lists[choiceKey]
+		// external lists are marked right after their list_name
+		external := &ast.Field{Label: ast.NewIdent("external"), Value: ast.NewBool(true)}
+		choiceStruct.Elts = append(choiceStruct.Elts[:1], append([]ast.Decl{external}, choiceStruct.Elts[1:]...)...)
 		choiceAsts[choiceKey] = newConjuctionOnNewLine(importInfo, "Choices", choiceStruct, false)
 	}
-	return choiceAsts, nil
+	for _, file := range form.fileBackedLists() {
+		choiceStruct, err := form.attachmentToChoiceStruct(file)
+		if err != nil {
+			errs.add(file, 0, "", "", err)
+			continue
+		}
+		choiceAsts[file] = newConjuctionOnNewLine(importInfo, "Choices", choiceStruct, false)
+	}
+	return choiceAsts, errs.err()
 }
 
-// extractChoices transform the choice sheet rows to a map with the key being the choice list_name and
-// the value being an array of all rows specific to the choice with the list_name
-func extractChoices(columns []string, rows [][]string) map[string][][]string {
-	listNameIdx := slices.Index(columns, "list_name")
-	choices := make(map[string][][]string)
-	for _, row := range rows {
-		if len(row) == 0 {
+// fileBackedLists returns the files the select_one_from_file and select_multiple_from_file
+// questions of the survey load their choices from
+func (form *xlsForm) fileBackedLists() []string {
+	typeIdx := slices.Index(form.surveyColumnHeaders, "type")
+	files := []string{}
+	for _, row := range form.survey {
+		if typeIdx >= len(row) {
+			continue
+		}
+		fields := strings.Fields(row[typeIdx])
+		if len(fields) == 2 && strings.HasSuffix(fields[0], "_from_file") && !slices.Contains(files, fields[1]) {
+			files = append(files, fields[1])
+		}
+	}
+	return files
+}
+
+// loadAttachments reads the csv files of the file backed choice lists in dir, the ones that
+// are missing are left out
+func (form *xlsForm) loadAttachments(dir string) error {
+	form.attachments = map[string][]byte{}
+	for _, file := range form.fileBackedLists() {
+		if filepath.Ext(file) != ".csv" {
 			continue
 		}
-		choice := choices[row[listNameIdx]]
-		if choice == nil {
-			choice = [][]string{}
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				log.Printf("missing attachment %s", file)
+				continue
+			}
+			return err
+		}
+		form.attachments[file] = b
+	}
+	return nil
+}
+
+// attachmentToChoiceStruct builds the choice list of a file backed select from its attachment. A
+// label column with no language is taken to be in the default language of the form. We keep an
+// empty list for attachments we don't have
+func (form *xlsForm) attachmentToChoiceStruct(file string) (*ast.StructLit, error) {
+	listName := strings.TrimSuffix(file, filepath.Ext(file))
+	choiceStruct := ast.NewStruct(&ast.Field{Label: ast.NewIdent("list_name"), Value: ast.NewString(listName)}, &ast.Field{Label: ast.NewIdent("choices"), Value: &ast.ListLit{}})
+	if b, ok := form.attachments[file]; ok {
+		r := csv.NewReader(bytes.NewReader(b))
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)
+		}
+		if len(rows) == 0 {
+			return nil, fmt.Errorf("empty file: %w", ErrInvalidXLSForm)
+		}
+		columns := slices.Clone(rows[0])
+		for idx, column := range columns {
+			if column == "label" {
+				columns[idx] = fmt.Sprintf("label::%s", form.defaultLanguage())
+			}
+		}
+		choiceStruct, err = buildChoiceStruct(listName, columns, rows[1:])
+		if err != nil {
+			return nil, err
 		}
-		choice = append(choice, row)
-		choices[row[listNameIdx]] = choice
 	}
-	return choices
+	fromFile := &ast.Field{Label: ast.NewIdent("from_file"), Value: ast.NewBool(true)}
+	choiceStruct.Elts = append(choiceStruct.Elts[:1], append([]ast.Decl{fromFile}, choiceStruct.Elts[1:]...)...)
+	return choiceStruct, nil
+}
+
+// defaultLanguage returns the language the untranslated columns are in. That's the one the decoder
+// was given, or else the default_language setting of the form or default when it has none
+func (form *xlsForm) defaultLanguage() string {
+	if form.defaultLang != "" {
+		return form.defaultLang
+	}
+	if idx := slices.Index(form.settingColumnHeaders, "default_language"); idx != -1 && len(form.settings) > 0 && idx < len(form.settings[0]) && form.settings[0][idx] != "" {
+		return form.settings[0][idx]
+	}
+	return "default"
+}
+
+// choiceLists builds the choice lists of a choices or external_choices sheet a row at a time so
+// that a large sheet doesn't have to be held in memory before we convert it
+type choiceLists struct {
+	columns     []string
+	listNameIdx int
+	// list names in the order they first appear
+	order []string
+	lists map[string]*ast.StructLit
+	// the row each list starts on
+	rows map[string]int
+	// the first problem found in each list and the row it is on
+	errs    map[string]error
+	errRows map[string]int
+}
+
+func newChoiceLists(columns []string) *choiceLists {
+	return &choiceLists{
+		columns:     columns,
+		listNameIdx: slices.Index(columns, "list_name"),
+		lists:       map[string]*ast.StructLit{},
+		rows:        map[string]int{},
+		errs:        map[string]error{},
+		errRows:     map[string]int{},
+	}
+}
+
+// add adds the choice in row to its list, rowNum is the number of the row in the sheet
+func (c *choiceLists) add(rowNum int, row []string) {
+	listName := cellValue(row, c.listNameIdx)
+	if listName == "" {
+		return
+	}
+	list, ok := c.lists[listName]
+	if !ok {
+		list = newChoiceStruct(listName)
+		c.lists[listName] = list
+		c.rows[listName] = rowNum
+		c.order = append(c.order, listName)
+	}
+	if c.errs[listName] != nil {
+		return
+	}
+	entry, err := buildChoiceEntry(c.columns, row)
+	if err != nil {
+		c.errs[listName] = err
+		c.errRows[listName] = rowNum
+		return
+	}
+	entries := list.Elts[1].(*ast.Field).Value.(*ast.ListLit)
+	entries.Elts = append(entries.Elts, entry)
+}
+
+// rowChoiceLists builds the choice lists of rows that have already been read
+func rowChoiceLists(columns []string, rows [][]string) *choiceLists {
+	lists := newChoiceLists(columns)
+	for idx, row := range rows {
+		lists.add(idx+2, row)
+	}
+	return lists
+}
+
+// newChoiceStruct returns the CUE struct of a choice list with no choices
+func newChoiceStruct(choiceListName string) *ast.StructLit {
+	entries := &ast.ListLit{Rbrack: token.Newline.Pos()}
+	return ast.NewStruct(&ast.Field{Label: ast.NewIdent("list_name"), Value: ast.NewString(choiceListName)}, &ast.Field{Label: ast.NewIdent("choices"), Value: entries})
 }
 
 // buildChoiceStruct builds a CUE struct from rows describing a choice
 func buildChoiceStruct(choiceListName string, columns []string, rows [][]string) (*ast.StructLit, error) {
-	entries := &ast.ListLit{Rbrack: token.Newline.Pos()}
-	choice := ast.NewStruct(&ast.Field{Label: ast.NewIdent("list_name"), Value: ast.NewString(choiceListName)}, &ast.Field{Label: ast.NewIdent("choices"), Value: entries})
+	choice := newChoiceStruct(choiceListName)
+	entries := choice.Elts[1].(*ast.Field).Value.(*ast.ListLit)
 	for _, row := range rows {
-		choiceEntry := &ast.Field{}
-		for idx, colVal := range row {
-			if columns[idx] == "name" {
-				choiceEntry.Label = ast.NewIdent(colVal)
-			} else if columns[idx] == "label" {
-				return nil, ErrInvalidLabel
-			} else if strings.HasPrefix(columns[idx], "label::") {
-				if choiceEntry.Value == nil {
-					choiceEntry.Value = ast.NewStruct()
-				}
-				label := &ast.Field{Label: &ast.Ident{Name: strings.TrimPrefix(columns[idx], "label::"), NamePos: token.Newline.Pos()}, Value: ast.NewString(colVal)}
-				choiceEntry.Value.(*ast.StructLit).Elts = append(choiceEntry.Value.(*ast.StructLit).Elts, label)
-			}
+		entry, err := buildChoiceEntry(columns, row)
+		if err != nil {
+			return nil, err
 		}
-		entry := ast.NewStruct(choiceEntry)
-		entry.Lbrace = token.Newline.Pos()
 		entries.Elts = append(entries.Elts, entry)
 	}
 	return choice, nil
 }
 
+// buildChoiceEntry builds the CUE struct of the choice in row
+func buildChoiceEntry(columns []string, row []string) (*ast.StructLit, error) {
+	choiceEntry := &ast.Field{}
+	var media, extraColumns *ast.StructLit
+	for idx, colVal := range row {
+		if idx >= len(columns) {
+			break
+		}
+		if columns[idx] == "name" {
+			choiceEntry.Label = ast.NewIdent(colVal)
+		} else if columns[idx] == "label" {
+			return nil, ErrInvalidLabel
+		} else if strings.HasPrefix(columns[idx], "label::") {
+			if choiceEntry.Value == nil {
+				choiceEntry.Value = ast.NewStruct()
+			}
+			label := &ast.Field{Label: &ast.Ident{Name: strings.TrimPrefix(columns[idx], "label::"), NamePos: token.Newline.Pos()}, Value: ast.NewString(colVal)}
+			choiceEntry.Value.(*ast.StructLit).Elts = append(choiceEntry.Value.(*ast.StructLit).Elts, label)
+		} else if IsMediaColumn(columns[idx]) {
+			if colVal == "" {
+				continue
+			}
+			if media == nil {
+				media = ast.NewStruct()
+			}
+			if err := addMediaColumn(media, columns[idx], colVal); err != nil {
+				return nil, err
+			}
+		} else if columns[idx] != "list_name" && columns[idx] != "" && colVal != "" {
+			// every other column is kept so that filters and custom columns survive a round trip
+			if extraColumns == nil {
+				extraColumns = ast.NewStruct()
+			}
+			column := &ast.Field{Label: &ast.Ident{Name: columns[idx], NamePos: token.Newline.Pos()}, Value: ast.NewString(colVal)}
+			extraColumns.Elts = append(extraColumns.Elts, column)
+		}
+	}
+	entry := ast.NewStruct(choiceEntry)
+	if media != nil {
+		entry.Elts = append(entry.Elts, &ast.Field{Label: ast.NewIdent("media"), Value: media})
+	}
+	if extraColumns != nil {
+		entry.Elts = append(entry.Elts, &ast.Field{Label: ast.NewIdent("filterCategory"), Value: extraColumns})
+	}
+	entry.Lbrace = token.Newline.Pos()
+	return entry, nil
+}
+
 // surveyToAst converts survey rows to valid survey exprs. We use the passed in struct n as the root level node which holds all the top level elements in the survey sheet
 func (form *xlsForm) surveyToAst(importInfo astutil.ImportInfo, n *ast.StructLit, idx int, choiceMap map[string]ast.Expr) (int, error) {
 	elList := &ast.ListLit{Rbrack: token.Newline.Pos()}
@@ -279,37 +772,118 @@ func (form *xlsForm) surveyToAst(importInfo astutil.ImportInfo, n *ast.StructLit
 			continue
 		}
 		idx++
-		elementType := row[slices.Index(form.surveyColumnHeaders, "type")]
-		if strings.HasPrefix(elementType, "begin") {
-			group, err := buildSurveyElement(true, form.surveyColumnHeaders, row, choiceMap)
+		begin, end := groupEdge(row[slices.Index(form.surveyColumnHeaders, "type")])
+		if begin {
+			group, err := buildSurveyElement(true, form.typedValues, form.surveyColumnHeaders, row, choiceMap)
 			if err != nil {
-				return idx, err
+				return idx, &DecodeError{Sheet: surveySheetName, Row: idx + 1, Err: err}
 			}
 			idx, err = form.surveyToAst(importInfo, group, idx, choiceMap)
 			if err != nil {
 				return idx, err
 			}
 			elList.Elts = append(elList.Elts, newConjuction(importInfo, "Group", group))
-		} else if strings.HasPrefix(elementType, "end") {
+		} else if end {
 			return idx, nil
 		} else {
-			el, err := buildSurveyElement(false, form.surveyColumnHeaders, row, choiceMap)
+			el, err := buildSurveyElement(false, form.typedValues, form.surveyColumnHeaders, row, choiceMap)
 			if err != nil {
-				return idx, err
+				return idx, &DecodeError{Sheet: surveySheetName, Row: idx + 1, Err: err}
 			}
 			elList.Elts = append(elList.Elts, newConjuction(importInfo, "Question", el))
 		}
 	}
 }
 
-func buildSurveyElement(nl bool, columnHeaders []string, row []string, choiceMap map[string]ast.Expr) (*ast.StructLit, error) {
+// checkSurvey finds the survey rows we can't build an element from, groups and repeats that are
+// not closed and select questions whose choice list we don't have
+func (form *xlsForm) checkSurvey(choiceMap map[string]ast.Expr) DecodeErrors {
+	type opening struct {
+		kind string
+		row  int
+	}
+	errs := DecodeErrors{}
+	typeIdx := slices.Index(form.surveyColumnHeaders, "type")
+	nameIdx := slices.Index(form.surveyColumnHeaders, "name")
+	groups := []opening{}
+	for idx, row := range form.survey {
+		rowNum := idx + 2
+		if len(row) == 0 {
+			continue
+		}
+		elementType := cellValue(row, typeIdx)
+		if elementType == "" {
+			errs.add(surveySheetName, rowNum, "type", "", ErrMissingValue)
+			continue
+		}
+		kind := strings.ReplaceAll(elementType, " ", "_")
+		begin, end := groupEdge(elementType)
+		if end {
+			if len(groups) == 0 {
+				errs.add(surveySheetName, rowNum, "type", elementType, fmt.Errorf("nothing to close: %w", ErrUnbalancedGroup))
+				continue
+			}
+			open := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			if want := strings.Replace(open.kind, "begin_", "end_", 1); kind != want {
+				errs.add(surveySheetName, rowNum, "type", elementType, fmt.Errorf("closes the %s on row %d: %w", open.kind, open.row, ErrUnbalancedGroup))
+			}
+			continue
+		}
+		if cellValue(row, nameIdx) == "" {
+			errs.add(surveySheetName, rowNum, "name", "", ErrMissingValue)
+		}
+		if begin {
+			groups = append(groups, opening{kind: kind, row: rowNum})
+		} else if strings.HasPrefix(elementType, "select_") {
+			if fields := strings.Fields(elementType); len(fields) < 2 {
+				errs.add(surveySheetName, rowNum, "type", elementType, fmt.Errorf("missing list name: %w", ErrUnknownChoiceList))
+			} else if _, ok := choiceMap[fields[1]]; !ok {
+				errs.add(surveySheetName, rowNum, "type", elementType, ErrUnknownChoiceList)
+			}
+		}
+	}
+	for _, open := range groups {
+		errs.add(surveySheetName, open.row, "type", open.kind, fmt.Errorf("never closed: %w", ErrUnbalancedGroup))
+	}
+	return errs
+}
+
+// groupEdge reports whether the survey element type begins or ends a group or repeat
+func groupEdge(elementType string) (begin bool, end bool) {
+	switch strings.ReplaceAll(elementType, " ", "_") {
+	case "begin_group", "begin_repeat":
+		return true, false
+	case "end_group", "end_repeat":
+		return false, true
+	}
+	return false, false
+}
+
+func cellValue(row []string, idx int) string {
+	if idx == -1 || idx >= len(row) {
+		return ""
+	}
+	return row[idx]
+}
+
+func buildSurveyElement(nl bool, typed bool, columnHeaders []string, row []string, choiceMap map[string]ast.Expr) (*ast.StructLit, error) {
 	element := ast.StructLit{}
 	translatables := map[string]*ast.StructLit{}
+	var media *ast.StructLit
 	for idx, header := range columnHeaders {
 		if idx >= len(row) || row[idx] == "" {
 			continue
 		}
-		if header == "type" && strings.HasPrefix(row[idx], "select_") {
+		if IsMediaColumn(header) {
+			if media == nil {
+				media = ast.NewStruct()
+				element.Elts = append(element.Elts, &ast.Field{Label: ast.NewIdent("media"), Value: media})
+			}
+			if err := addMediaColumn(media, header, row[idx]); err != nil {
+				return nil, err
+			}
+		} else if header == "type" && strings.HasPrefix(row[idx], "select_") {
 			raw := strings.SplitAfterN(row[idx], " ", 2)
 			qtype, choice := strings.TrimSpace(raw[0]), strings.TrimSpace(raw[1])
 			element.Elts = append(element.Elts, &ast.Field{Label: ast.NewIdent(header), Value: ast.NewString(qtype)}, &ast.Field{Label: ast.NewIdent("choices"), Value: choiceMap[choice]})
@@ -324,6 +898,12 @@ func buildSurveyElement(nl bool, columnHeaders []string, row []string, choiceMap
 				translatables[col] = labels
 			}
 			translatables[col].Elts = append(translatables[col].Elts, &ast.Field{Label: &ast.Ident{Name: lang, NamePos: token.Newline.Pos()}, Value: ast.NewString(row[idx])})
+		} else if typed {
+			qtype := ""
+			if typeIdx := slices.Index(columnHeaders, "type"); typeIdx != -1 && typeIdx < len(row) {
+				qtype = row[typeIdx]
+			}
+			element.Elts = append(element.Elts, &ast.Field{Label: ast.NewIdent(header), Value: typedValue(header, qtype, row[idx])})
 		} else {
 			element.Elts = append(element.Elts, &ast.Field{Label: ast.NewIdent(header), Value: ast.NewString(row[idx])})
 		}
@@ -331,6 +911,82 @@ func buildSurveyElement(nl bool, columnHeaders []string, row []string, choiceMap
 	return &element, nil
 }
 
+// typedValue returns the CUE value of a typed survey column. Values are only converted when the
+// encoder writes them back the same way so that yes stays yes but true() stays a string
+func typedValue(column, qtype, value string) ast.Expr {
+	kind, ok := typedColumns[column]
+	if column == "default" && (qtype == "integer" || qtype == "decimal") {
+		kind, ok = cue.NumberKind, true
+	}
+	if !ok {
+		return ast.NewString(value)
+	}
+	switch kind {
+	case cue.BoolKind:
+		if value == "yes" || value == "no" {
+			return ast.NewBool(value == "yes")
+		}
+	case cue.IntKind, cue.NumberKind:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(i, 10) == value {
+			return ast.NewLit(token.INT, value)
+		}
+		if f, err := strconv.ParseFloat(value, 64); kind == cue.NumberKind && err == nil && strconv.FormatFloat(f, 'f', -1, 64) == value {
+			return ast.NewLit(token.FLOAT, value)
+		}
+	}
+	return ast.NewString(value)
+}
+
+// addMediaColumn adds the value of a media column to the media struct of an element
+func addMediaColumn(media *ast.StructLit, column, value string) error {
+	mediaType, lang, err := GetMediaFromCol(column)
+	if err != nil {
+		return err
+	}
+	var field *ast.Field
+	for _, el := range media.Elts {
+		if name, _, _ := ast.LabelName(el.(*ast.Field).Label); name == mediaType {
+			field = el.(*ast.Field)
+		}
+	}
+	if lang == "" {
+		if field != nil {
+			return fmt.Errorf("%s is also translated: %w", column, ErrInvalidMedia)
+		}
+		media.Elts = append(media.Elts, &ast.Field{Label: &ast.Ident{Name: mediaType, NamePos: token.Newline.Pos()}, Value: ast.NewString(value)})
+		return nil
+	}
+	if field == nil {
+		field = &ast.Field{Label: &ast.Ident{Name: mediaType, NamePos: token.Newline.Pos()}, Value: ast.NewStruct()}
+		media.Elts = append(media.Elts, field)
+	}
+	langs, ok := field.Value.(*ast.StructLit)
+	if !ok {
+		return fmt.Errorf("%s is also untranslated: %w", column, ErrInvalidMedia)
+	}
+	langs.Elts = append(langs.Elts, &ast.Field{Label: &ast.Ident{Name: lang, NamePos: token.Newline.Pos()}, Value: ast.NewString(value)})
+	return nil
+}
+
+// entitiesToAst converts the entities sheet to the form_entities declaration, ODK only allows a
+// form to declare a single entity
+func (form *xlsForm) entitiesToAst(importInfo astutil.ImportInfo) (*ast.Field, error) {
+	if len(form.entities) == 0 {
+		return nil, nil
+	}
+	if len(form.entities) > 1 {
+		return nil, &DecodeError{Sheet: entitiesSheetName, Row: 3, Err: fmt.Errorf("found %d entity declarations: %w", len(form.entities), ErrInvalidXLSForm)}
+	}
+	entity := ast.NewStruct()
+	for idx, header := range form.entityColumnHeaders {
+		if idx >= len(form.entities[0]) || form.entities[0][idx] == "" {
+			continue
+		}
+		entity.Elts = append(entity.Elts, &ast.Field{Label: ast.NewIdent(header), Value: ast.NewString(form.entities[0][idx])})
+	}
+	return &ast.Field{Label: ast.NewIdent("form_entities"), Value: newConjuction(importInfo, "Entity", entity)}, nil
+}
+
 func (form *xlsForm) settingsToAst(importInfo astutil.ImportInfo) *ast.Field {
 	if len(form.settings) != 1 {
 		return nil
@@ -349,40 +1005,111 @@ func (form *xlsForm) WriteToBuffer() (*bytes.Buffer, error) {
 			log.Println(err)
 		}
 	}()
-	err := writeSheet(formFile, surveySheetName, form.surveyColumnHeaders, form.survey)
+	styles, err := newWorkbookStyles(formFile)
 	if err != nil {
 		return nil, err
 	}
+	sheets := []sheet{{name: surveySheetName, headers: form.surveyColumnHeaders, rows: form.survey, rowOpts: form.surveyRowOpts(styles)}}
 	if len(form.choices) > 0 {
-		err = writeSheet(formFile, choiceSheetName, form.choiceColumnHeaders, form.choices)
-		if err != nil {
+		sheets = append(sheets, sheet{name: choiceSheetName, headers: form.choiceColumnHeaders, rows: form.choices})
+	}
+	if len(form.externalChoices) > 0 {
+		sheets = append(sheets, sheet{name: externalChoiceSheetName, headers: form.externalChoiceColumnHeaders, rows: form.externalChoices})
+	}
+	if len(form.entities) > 0 {
+		sheets = append(sheets, sheet{name: entitiesSheetName, headers: form.entityColumnHeaders, rows: form.entities})
+	}
+	if len(form.settings) > 0 {
+		sheets = append(sheets, sheet{name: settingsSheetName, headers: form.settingColumnHeaders, rows: form.settings})
+	}
+	dropdowns := form.dropdowns(sheets)
+	// every sheet is added before any is streamed, deleting or hiding a sheet afterwards would
+	// make excelize read back the ones already written. The survey takes the default sheet
+	if err := formFile.SetSheetName("Sheet1", surveySheetName); err != nil {
+		return nil, err
+	}
+	for _, s := range sheets[1:] {
+		if _, err := formFile.NewSheet(s.name); err != nil {
 			return nil, err
 		}
 	}
-	if len(form.settings) > 0 {
-		err = writeSheet(formFile, settingsSheetName, form.settingColumnHeaders, form.settings)
-		if err != nil {
+	if len(dropdowns) > 0 {
+		if _, err := formFile.NewSheet(validationSheetName); err != nil {
+			return nil, err
+		}
+		if err := formFile.SetSheetVisible(validationSheetName, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range sheets {
+		if err := writeSheet(formFile, s, styles, dropdowns); err != nil {
 			return nil, err
 		}
 	}
-	formFile.DeleteSheet("Sheet1")
+	if err := writeDropdownValues(formFile, dropdowns); err != nil {
+		return nil, err
+	}
 	return formFile.WriteToBuffer()
 }
 
-func writeSheet(f *excelize.File, sheet string, headers []string, rows [][]string) error {
-	_, err := f.NewSheet(sheet)
+// sheet is a worksheet of the form, rowOpts are the outline level and style of each row
+type sheet struct {
+	name    string
+	headers []string
+	rows    [][]string
+	rowOpts []excelize.RowOpts
+}
+
+// writeSheet streams the rows of s into the workbook, the rows never sit in excelize's cell
+// model so big choice sheets are written in one pass
+func writeSheet(f *excelize.File, s sheet, styles *workbookStyles, dropdowns []dropdown) error {
+	sw, err := f.NewStreamWriter(s.name)
 	if err != nil {
 		return err
 	}
-	setDefaultColumnWidth(sheet, f)
-	f.SetSheetRow(sheet, "A1", &headers)
-	for idx, row := range rows {
-		err = f.SetSheetRow(sheet, fmt.Sprintf("A%d", idx+2), &row)
+	if err := setDefaultColumnWidth(sw, s.name); err != nil {
+		return err
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	if err := sw.SetRow("A1", rowValues(s.headers), excelize.RowOpts{StyleID: styles.header}); err != nil {
+		return err
+	}
+	for idx, row := range s.rows {
+		opts := excelize.RowOpts{}
+		if idx < len(s.rowOpts) {
+			opts = s.rowOpts[idx]
+		}
+		cell, err := excelize.CoordinatesToCellName(1, idx+2)
 		if err != nil {
 			return err
 		}
+		if err := sw.SetRow(cell, rowValues(row), opts); err != nil {
+			return err
+		}
 	}
-	return nil
+	// validations are kept on the worksheet the stream writer adds them from when it flushes
+	for _, d := range dropdowns {
+		if d.sheet != s.name {
+			continue
+		}
+		if err := f.AddDataValidation(s.name, d.validation()); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
+
+// rowValues leaves out empty cells so that they are not written at all
+func rowValues(row []string) []interface{} {
+	values := make([]interface{}, len(row))
+	for idx, value := range row {
+		if value != "" {
+			values[idx] = value
+		}
+	}
+	return values
 }
 
 func newConjuctionOnNewLine(info astutil.ImportInfo, def string, sl ast.Expr, newLine bool) ast.Expr {
@@ -1,9 +1,12 @@
 package xlsform
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"cuelang.org/go/cue/ast"
@@ -114,7 +117,7 @@ func TestBuildSurveyElement(t *testing.T) {
 	}
 	choiceMap := make(map[string]ast.Expr)
 	for _, tc := range testCases {
-		result, err := buildSurveyElement(true, tc.colHeaders, tc.row, choiceMap)
+		result, err := buildSurveyElement(true, false, tc.colHeaders, tc.row, choiceMap)
 		if err != nil && !errors.Is(tc.err, ErrInvalidLabel) {
 			t.Fatalf("have %s but want %s", err, tc.err)
 		}
@@ -174,25 +177,26 @@ father:
 				label: "English (en)": "Father’s Next of Kin"
 				children: [
 					test.#Question & {
-						type: "select_one"
-						choices: test.#Choices & {
-							list_name: "yes_no"
-							choices: [
-								{
-									yes: "English (en)": "Yes"
-								},
-								{
-									no: "English (en)": "No"
-								},
-							]
-						}
-						name: "has_next_of_kin"
+						type:    "select_one"
+						choices: yes_no
+						name:    "has_next_of_kin"
 						label: "English (en)": "Does your Father have a Next of Kin?"
 					},
 				]
 			},
 		]
 	}
+yes_no: test.#Choices & {
+	list_name: "yes_no"
+	choices: [
+		{
+			yes: "English (en)": "Yes"
+		},
+		{
+			no: "English (en)": "No"
+		},
+	]
+}
 form_settings:
 	test.#Settings & {
 		type:       "settings"
@@ -220,3 +224,783 @@ form_settings:
 		})
 	}
 }
+
+func TestDecodeChoiceColumns(t *testing.T) {
+	sheets := map[string][][]string{
+		"survey": {
+			{"type", "name", "label::English (en)", "choice_filter"},
+			{"select_one ward", "ward", "Ward", "county=${county}"},
+		},
+		"choices": {
+			{"list_name", "name", "label::English (en)", "county", "code"},
+			{"ward", "kilimani", "Kilimani", "nairobi"},
+			{"ward", "likoni", "Likoni", "mombasa", "002"},
+		},
+	}
+	want := `package main
+
+import "test"
+
+ward:
+	test.#Question & {
+		type:    "select_one"
+		choices: ward_choices
+		name:    "ward"
+		label: "English (en)": "Ward"
+		choice_filter: "county=${county}"
+	}
+ward_choices: test.#Choices & {
+	list_name: "ward"
+	choices: [
+		{
+			kilimani: "English (en)": "Kilimani"
+			filterCategory: county: "nairobi"
+		},
+		{
+			likoni: "English (en)": "Likoni"
+			filterCategory: {
+				county: "mombasa"
+				code:   "002"
+			}
+		},
+	]
+}
+`
+	b, err := NewDecoder("test").DecodeSheets(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); have != want {
+		t.Fatalf("have\n%s\nwant\n%s", have, want)
+	}
+}
+
+func TestDecodeSharedChoices(t *testing.T) {
+	sheets := map[string][][]string{
+		"survey": {
+			{"type", "name", "label::English (en)"},
+			{"select_one yes_no", "is_home", "Is he home?"},
+			{"select_one yes_no", "yes_no", "Is she home?"},
+		},
+		"choices": {
+			{"list_name", "name", "label::English (en)"},
+			{"yes_no", "yes", "Yes"},
+			{"yes_no", "no", "No"},
+		},
+	}
+	want := `package main
+
+import "test"
+
+is_home:
+	test.#Question & {
+		type:    "select_one"
+		choices: yes_no_choices
+		name:    "is_home"
+		label: "English (en)": "Is he home?"
+	}
+yes_no:
+	test.#Question & {
+		type:    "select_one"
+		choices: yes_no_choices
+		name:    "yes_no"
+		label: "English (en)": "Is she home?"
+	}
+yes_no_choices: test.#Choices & {
+	list_name: "yes_no"
+	choices: [
+		{
+			yes: "English (en)": "Yes"
+		},
+		{
+			no: "English (en)": "No"
+		},
+	]
+}
+`
+	b, err := NewDecoder("test").DecodeSheets(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); have != want {
+		t.Fatalf("have\n%s\nwant\n%s", have, want)
+	}
+}
+
+func TestDecodeMedia(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sheets map[string][][]string
+		want   string
+		err    error
+	}{
+		{
+			name: "media",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)", "media::image::English (en)", "media::image::Swahili (sw)", "media::video"},
+					{"select_one animals", "animal", "Which animal is this?", "animals.png", "wanyama.png", "animals.mp4"},
+				},
+				"choices": {
+					{"list_name", "name", "label::English (en)", "media::big-image"},
+					{"animals", "cow", "Cow", "cow.png"},
+					{"animals", "goat", "Goat"},
+				},
+			},
+			want: `package main
+
+import "test"
+
+animal:
+	test.#Question & {
+		type:    "select_one"
+		choices: animals
+		name:    "animal"
+		label: "English (en)": "Which animal is this?"
+		media: {
+			image: {
+				"English (en)": "animals.png"
+				"Swahili (sw)": "wanyama.png"
+			}
+			video: "animals.mp4"
+		}
+	}
+animals: test.#Choices & {
+	list_name: "animals"
+	choices: [
+		{
+			cow: "English (en)": "Cow"
+			media: "big-image": "cow.png"
+		},
+		{
+			goat: "English (en)": "Goat"
+		},
+	]
+}
+`,
+		},
+		{
+			name: "unknown media type",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)", "media::picture"},
+					{"note", "intro", "Hello", "intro.png"},
+				},
+			},
+			err: ErrInvalidMedia,
+		},
+		{
+			name: "translated and untranslated media",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)", "media::image::English (en)", "media::image"},
+					{"note", "intro", "Hello", "intro.png", "intro.png"},
+				},
+			},
+			err: ErrInvalidMedia,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewDecoder("test").DecodeSheets(tc.sheets)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %v, want %v", err, tc.err)
+			}
+			if have := string(b); have != tc.want {
+				t.Fatalf("have\n%s\nwant\n%s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeExternalChoices(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sheets map[string][][]string
+		want   string
+		err    error
+	}{
+		{
+			name: "external choices",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)", "choice_filter"},
+					{"select_one_external ward", "ward", "Ward", "county=${county}"},
+				},
+				"external_choices": {
+					{"list_name", "name", "label::English (en)", "county"},
+					{"ward", "kilimani", "Kilimani", "nairobi"},
+				},
+			},
+			want: `package main
+
+import "test"
+
+ward:
+	test.#Question & {
+		type:    "select_one_external"
+		choices: ward_choices
+		name:    "ward"
+		label: "English (en)": "Ward"
+		choice_filter: "county=${county}"
+	}
+ward_choices: test.#Choices & {
+	list_name: "ward"
+	external:  true
+	choices: [
+		{
+			kilimani: "English (en)": "Kilimani"
+			filterCategory: county: "nairobi"
+		},
+	]
+}
+`,
+		},
+		{
+			name: "list in both sheets",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"select_one_external ward", "ward", "Ward"},
+				},
+				"choices": {
+					{"list_name", "name", "label::English (en)"},
+					{"ward", "kilimani", "Kilimani"},
+				},
+				"external_choices": {
+					{"list_name", "name", "label::English (en)"},
+					{"ward", "kilimani", "Kilimani"},
+				},
+			},
+			err: ErrInvalidXLSForm,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewDecoder("test").DecodeSheets(tc.sheets)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %v, want %v", err, tc.err)
+			}
+			if have := string(b); have != tc.want {
+				t.Fatalf("have\n%s\nwant\n%s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEntities(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sheets map[string][][]string
+		want   string
+		err    error
+	}{
+		{
+			name: "entities",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)", "save_to"},
+					{"text", "species", "Tree species", "species"},
+				},
+				"entities": {
+					{"list_name", "label", "entity_id", "update_if"},
+					{"trees", "${species}", "${tree_id}", "true()"},
+				},
+			},
+			want: `package main
+
+import "test"
+
+species:
+	test.#Question & {
+		type: "text"
+		name: "species"
+		label: "English (en)": "Tree species"
+		save_to: "species"
+	}
+form_entities:
+	test.#Entity & {
+		list_name: "trees"
+		label:     "${species}"
+		entity_id: "${tree_id}"
+		update_if: "true()"
+	}
+`,
+		},
+		{
+			name: "missing label column",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"text", "species", "Tree species"},
+				},
+				"entities": {
+					{"list_name"},
+					{"trees"},
+				},
+			},
+			err: ErrInvalidXLSFormSheet,
+		},
+		{
+			name: "more than one entity",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"text", "species", "Tree species"},
+				},
+				"entities": {
+					{"list_name", "label"},
+					{"trees", "${species}"},
+					{"shrubs", "${species}"},
+				},
+			},
+			err: ErrInvalidXLSForm,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewDecoder("test").DecodeSheets(tc.sheets)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("have %v, want %v", err, tc.err)
+			}
+			if have := string(b); have != tc.want {
+				t.Fatalf("have\n%s\nwant\n%s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAttachments(t *testing.T) {
+	sheets := map[string][][]string{
+		"survey": {
+			{"type", "name", "label::English (en)"},
+			{"select_one_from_file trees.csv", "tree", "Which tree?"},
+			{"select_multiple_from_file shrubs.csv", "shrubs", "Which shrubs?"},
+		},
+		"settings": {
+			{"form_title", "default_language"},
+			{"Trees", "English (en)"},
+		},
+	}
+	want := `package main
+
+import "test"
+
+tree:
+	test.#Question & {
+		type:    "select_one_from_file"
+		choices: trees
+		name:    "tree"
+		label: "English (en)": "Which tree?"
+	}
+shrubs:
+	test.#Question & {
+		type:    "select_multiple_from_file"
+		choices: shrubs_choices
+		name:    "shrubs"
+		label: "English (en)": "Which shrubs?"
+	}
+trees: test.#Choices & {
+	list_name: "trees"
+	from_file: true
+	choices: [
+		{
+			oak: "English (en)": "Oak"
+			filterCategory: region: "north"
+		},
+		{
+			acacia: "English (en)": "Acacia"
+			filterCategory: region: "south"
+		},
+	]
+}
+shrubs_choices: test.#Choices & {
+	list_name: "shrubs"
+	from_file: true
+	choices: []
+}
+form_settings:
+	test.#Settings & {
+		type:             "settings"
+		form_title:       "Trees"
+		default_language: "English (en)"
+	}
+`
+	decoder := NewDecoder("test")
+	decoder.UseAttachmentDir("testdata")
+	b, err := decoder.DecodeSheets(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); have != want {
+		t.Fatalf("have\n%s\nwant\n%s", have, want)
+	}
+}
+
+func TestDecodeDefaultLang(t *testing.T) {
+	sheets := map[string][][]string{
+		"survey": {
+			{"type", "name", "label", "hint", "label::Swahili (sw)"},
+			{"select_one yes_no", "is_home", "Is he home?", "Your father", "Yuko nyumbani?"},
+		},
+		"choices": {
+			{"list_name", "name", "label"},
+			{"yes_no", "yes", "Yes"},
+		},
+	}
+	want := `package main
+
+import "test"
+
+is_home:
+	test.#Question & {
+		type:    "select_one"
+		choices: yes_no
+		name:    "is_home"
+		label: {
+			"English (en)": "Is he home?"
+			"Swahili (sw)": "Yuko nyumbani?"
+		}
+		hint: "English (en)": "Your father"
+	}
+yes_no: test.#Choices & {
+	list_name: "yes_no"
+	choices: [
+		{
+			yes: "English (en)": "Yes"
+		},
+	]
+}
+`
+	decoder := NewDecoder("test")
+	if _, err := decoder.DecodeSheets(sheets); !errors.Is(err, ErrInvalidLabel) {
+		t.Fatalf("have %v, want %v without a default language", err, ErrInvalidLabel)
+	}
+	decoder.UseDefaultLang("English (en)")
+	b, err := decoder.DecodeSheets(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); have != want {
+		t.Fatalf("have\n%s\nwant\n%s", have, want)
+	}
+	if sheets["survey"][0][2] != "label" {
+		t.Fatal("the sheets we were given have been changed")
+	}
+}
+
+// largeChoicesSheets returns a form whose choices sheet has a list of n villages
+func largeChoicesSheets(n int) map[string][][]string {
+	choices := [][]string{{"list_name", "name", "label::English (en)", "county"}}
+	for i := 0; i < n; i++ {
+		county := fmt.Sprintf("county_%d", i%47)
+		choices = append(choices, []string{"village", fmt.Sprintf("village_%d", i), fmt.Sprintf("Village %d", i), county})
+		if i%1000 == 0 {
+			// lists are not always in one block and rows can be empty
+			choices = append(choices, []string{"yes_no", fmt.Sprintf("answer_%d", i), "Answer"}, []string{})
+		}
+	}
+	return map[string][][]string{
+		"survey": {
+			{"type", "name", "label::English (en)", "choice_filter"},
+			{"select_one yes_no", "consent", "Do you consent?"},
+			{"select_one_external ward", "ward", "Ward"},
+			{"select_one village", "village", "Village", "county=${ward}"},
+		},
+		"choices": choices,
+		"external_choices": {
+			{"list_name", "name", "label::English (en)"},
+			{"ward", "kilimani", "Kilimani"},
+		},
+	}
+}
+
+func largeChoicesWorkbook(t testing.TB, n int) []byte {
+	sheets := largeChoicesSheets(n)
+	form := &xlsForm{
+		surveyColumnHeaders:         sheets["survey"][0],
+		survey:                      sheets["survey"][1:],
+		choiceColumnHeaders:         sheets["choices"][0],
+		choices:                     sheets["choices"][1:],
+		externalChoiceColumnHeaders: sheets["external_choices"][0],
+		externalChoices:             sheets["external_choices"][1:],
+	}
+	b, err := form.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeStream(t *testing.T) {
+	decoder := NewDecoder("test")
+	want, err := decoder.DecodeSheets(largeChoicesSheets(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := decoder.Decode(bytes.NewReader(largeChoicesWorkbook(t, 5000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != string(want) {
+		t.Fatalf("streamed decode differs from decoding the rows\n%s", have)
+	}
+}
+
+func BenchmarkDecodeLargeChoices(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		workbook := largeChoicesWorkbook(b, n)
+		b.Run(fmt.Sprintf("%d choices", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewDecoder("test").Decode(bytes.NewReader(workbook)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeTypedValues(t *testing.T) {
+	sheets := map[string][][]string{
+		"survey": {
+			{"type", "name", "label::English (en)", "required", "repeat_count", "read_only", "default"},
+			{"begin_repeat", "household", "Household", "", "3"},
+			{"integer", "members", "Members", "yes", "", "", "2"},
+			{"decimal", "income", "Income", "true()", "", "no", "2.50"},
+			{"end_repeat"},
+			{"text", "code", "Code", "", "", "", "007"},
+		},
+	}
+	testCases := []struct {
+		name  string
+		typed bool
+		want  string
+	}{
+		{
+			name: "strings",
+			want: `package main
+
+import "test"
+
+household:
+	test.#Group & {
+		type: "begin_repeat"
+		name: "household"
+		label: "English (en)": "Household"
+		repeat_count: "3"
+		children: [
+			test.#Question & {
+				type: "integer"
+				name: "members"
+				label: "English (en)": "Members"
+				required: "yes"
+				default:  "2"
+			},
+			test.#Question & {
+				type: "decimal"
+				name: "income"
+				label: "English (en)": "Income"
+				required:  "true()"
+				read_only: "no"
+				default:   "2.50"
+			},
+		]
+	}
+code:
+	test.#Question & {
+		type: "text"
+		name: "code"
+		label: "English (en)": "Code"
+		default: "007"
+	}
+`,
+		},
+		{
+			name:  "typed",
+			typed: true,
+			want: `package main
+
+import "test"
+
+household:
+	test.#Group & {
+		type: "begin_repeat"
+		name: "household"
+		label: "English (en)": "Household"
+		repeat_count: 3
+		children: [
+			test.#Question & {
+				type: "integer"
+				name: "members"
+				label: "English (en)": "Members"
+				required: true
+				default:  2
+			},
+			test.#Question & {
+				type: "decimal"
+				name: "income"
+				label: "English (en)": "Income"
+				required:  "true()"
+				read_only: false
+				default:   "2.50"
+			},
+		]
+	}
+code:
+	test.#Question & {
+		type: "text"
+		name: "code"
+		label: "English (en)": "Code"
+		default: "007"
+	}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder := NewDecoder("test")
+			decoder.UseTypedValues(tc.typed)
+			b, err := decoder.DecodeSheets(sheets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := string(b); have != tc.want {
+				t.Fatalf("have\n%s\nwant\n%s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sheets map[string][][]string
+		want   []string
+		err    error
+	}{
+		{
+			name: "headers",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "label:English", "media::picture"},
+				},
+				"choices": {
+					{"list_name", "name", "label"},
+				},
+			},
+			want: []string{
+				"survey:1: name: found xlsform sheet missing a required column",
+				"survey:1: label:English: found translatable column with no language code",
+				"survey:1: media::picture: found media column with an unknown media type",
+				"choices:1: label: found translatable column with no language code",
+			},
+			err: ErrInvalidXLSFormSheet,
+		},
+		{
+			name: "rows",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"begin group", "household", "Household"},
+					{"select_one ages", "age", "Age"},
+					{"select_one", "sex", "Sex"},
+					{"end_repeat"},
+					{"", "", "Orphaned label"},
+					{"begin_repeat", "child", "Child"},
+					{"text", "", "Name"},
+					{"end_group"},
+				},
+			},
+			want: []string{
+				`survey:3: type "select_one ages": found select question with an unknown choice list`,
+				`survey:4: type "select_one": missing list name: found select question with an unknown choice list`,
+				`survey:5: type "end_repeat": closes the begin_group on row 2: found group or repeat that is not closed properly`,
+				`survey:6: type: found row missing a required value`,
+				`survey:8: name: found row missing a required value`,
+				`survey:9: type "end_group": closes the begin_repeat on row 7: found group or repeat that is not closed properly`,
+			},
+			err: ErrUnbalancedGroup,
+		},
+		{
+			name: "unclosed",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"end_group"},
+					{"begin_group", "household", "Household"},
+				},
+			},
+			want: []string{
+				`survey:2: type "end_group": nothing to close: found group or repeat that is not closed properly`,
+				`survey:3: type "begin_group": never closed: found group or repeat that is not closed properly`,
+			},
+			err: ErrUnbalancedGroup,
+		},
+		{
+			name: "choices",
+			sheets: map[string][][]string{
+				"survey": {
+					{"type", "name", "label::English (en)"},
+					{"text", "family_name", "Family name"},
+				},
+				"choices": {
+					{"list_name", "name", "label::English (en)", "media::image", "media::image::English (en)"},
+					{"yes_no", "yes", "Yes"},
+					{},
+					{"yes_no", "no", "No", "no.png", "no_en.png"},
+				},
+				"external_choices": {
+					{"list_name", "name", "label::English (en)", "media::audio", "media::audio::English (en)"},
+					{"ward", "kilimani", "Kilimani"},
+					{"ward", "nyali", "Nyali", "nyali.mp3", "nyali_en.mp3"},
+				},
+			},
+			want: []string{
+				`choices:4: list_name "yes_no": media::image::English (en) is also untranslated: found media column with an unknown media type`,
+				`external_choices:3: list_name "ward": media::audio::English (en) is also untranslated: found media column with an unknown media type`,
+			},
+			err: ErrInvalidMedia,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder("test").DecodeSheets(tc.sheets)
+			checkDecodeErrors(t, err, tc.err, tc.want)
+		})
+	}
+	// the choices sheets of a workbook are streamed instead, their rows are counted as they are read
+	sheets := testCases[len(testCases)-1].sheets
+	form := &xlsForm{
+		surveyColumnHeaders:         sheets["survey"][0],
+		survey:                      sheets["survey"][1:],
+		choiceColumnHeaders:         sheets["choices"][0],
+		choices:                     sheets["choices"][1:],
+		externalChoiceColumnHeaders: sheets["external_choices"][0],
+		externalChoices:             sheets["external_choices"][1:],
+	}
+	b, err := form.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDecoder("test").Decode(bytes.NewReader(b.Bytes()))
+	checkDecodeErrors(t, err, ErrInvalidMedia, testCases[len(testCases)-1].want)
+}
+
+func checkDecodeErrors(t *testing.T, err, wantErr error, want []string) {
+	t.Helper()
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("have %v, want %v", err, wantErr)
+	}
+	var decodeErrs DecodeErrors
+	if !errors.As(err, &decodeErrs) {
+		t.Fatalf("have %T, want DecodeErrors", err)
+	}
+	have := []string{}
+	for _, decodeErr := range decodeErrs {
+		have = append(have, decodeErr.Error())
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("have\n%s\nwant\n%s", strings.Join(have, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -2,9 +2,11 @@ package xlsform
 
 import (
 	"bytes"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
-	"slices"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -12,15 +14,21 @@ import (
 )
 
 var (
+	ErrMissingField = errors.New("found survey element missing a required field")
+
 	langRe           = regexp.MustCompile(`(?P<column>\w+)::(?P<lang>.+)`)
+	mediaRe          = regexp.MustCompile(`^media::(?P<media>[\w-]+)(?:::(?P<lang>.+))?$`)
 	TranslatableCols = []string{"label", "required_message", "constraint_message", "hint"}
-	surveyColumns    = []string{"type", "name", "label", "required", "required_message", "relevant", "repeat_count", "constraint", "constraint_message", "hint", "choice_filter", "read_only", "calculation", "appearance", "default"}
-	choiceColumns    = []string{"list_name", "name", "label"}
+	MediaTypes       = []string{"image", "big-image", "audio", "video"}
+	surveyColumns    = []string{"type", "name", "label", "required", "required_message", "relevant", "repeat_count", "constraint", "constraint_message", "hint", "media", "choice_filter", "read_only", "calculation", "appearance", "default", "save_to"}
+	choiceColumns    = []string{"list_name", "name", "label", "media"}
+	entityColumns    = []string{"list_name", "label", "entity_id", "create_if", "update_if"}
 	settingColumns   = []string{"form_title", "form_id", "public_key", "submission_url", "default_language", "style", "version", "instance_name"}
 )
 
 type CueForm struct {
 	SurveyElements []*cue.Value
+	Entities       *cue.Value
 	Settings       *cue.Value
 }
 
@@ -42,6 +50,11 @@ func parseCueFormFromVal(val *cue.Value) (*CueForm, error) {
 		element := fieldIter.Value()
 		if l, _ := element.Label(); l == "form_settings" {
 			form.Settings = &element
+		} else if l == "form_entities" {
+			form.Entities = &element
+		} else if isChoiceList(element) {
+			// a list declared once that the questions refer to, it's encoded with them
+			continue
 		} else {
 			form.SurveyElements = append(form.SurveyElements, &element)
 		}
@@ -53,88 +66,128 @@ func (c *CueForm) toXLSForm() (*xlsForm, error) {
 	survey := []map[string]string{}
 	choices := []map[string]string{}
 	state := &encodeState{
-		surveyColHeaders: make(map[string]struct{}),
-		choiceColHeaders: make(map[string]struct{}),
+		surveyColHeaders:         make(map[string]struct{}),
+		choiceColHeaders:         make(map[string]struct{}),
+		externalChoiceColHeaders: make(map[string]struct{}),
+		choiceLists:              make(map[string][]map[string]string),
+		externalChoiceLists:      make(map[string][]map[string]string),
+		attachments:              make(map[string][]byte),
 	}
 
+	errs := EncodeErrors{}
 	for _, element := range c.SurveyElements {
-		err := state.elementToRows(element, &survey, &choices)
-		if err != nil {
-			return nil, err
-		}
+		errs.add(*element, state.elementToRows(element, &survey, &choices))
 	}
 
 	orderSurveyColHeaders := getHeadersInOrder(state.surveyColHeaders, surveyColumns)
-	surveyRows := [][]string{}
-	for _, element := range survey {
-		row := make([]string, len(orderSurveyColHeaders))
-		for key, val := range element {
-			row[slices.Index(orderSurveyColHeaders, key)] = val
-		}
-		surveyRows = append(surveyRows, row)
+	form := &xlsForm{surveyColumnHeaders: orderSurveyColHeaders, survey: rowsInOrder(survey, orderSurveyColHeaders), attachments: state.attachments}
+
+	if len(choices) > 0 {
+		form.choiceColumnHeaders = getHeadersInOrder(state.choiceColHeaders, choiceColumns)
+		form.choices = rowsInOrder(choices, form.choiceColumnHeaders)
 	}
 
-	form := &xlsForm{surveyColumnHeaders: orderSurveyColHeaders, survey: surveyRows}
+	if len(state.externalChoices) > 0 {
+		form.externalChoiceColumnHeaders = getHeadersInOrder(state.externalChoiceColHeaders, choiceColumns)
+		form.externalChoices = rowsInOrder(state.externalChoices, form.externalChoiceColumnHeaders)
+	}
 
-	if len(choices) > 0 {
-		orderedChoiceColHeaders := getHeadersInOrder(state.choiceColHeaders, choiceColumns)
-		choiceRows := [][]string{}
-		for _, element := range choices {
-			row := make([]string, len(orderedChoiceColHeaders))
-			for key, val := range element {
-				row[slices.Index(orderedChoiceColHeaders, key)] = val
-			}
-			choiceRows = append(choiceRows, row)
-		}
-		form.choiceColumnHeaders = orderedChoiceColHeaders
-		form.choices = choiceRows
+	if c.Entities != nil {
+		entityHeaders := map[string]struct{}{}
+		row, err := entityToRow(c.Entities, entityHeaders)
+		errs.add(*c.Entities, err)
+		form.entityColumnHeaders = getHeadersInOrder(entityHeaders, entityColumns)
+		form.entities = rowsInOrder([]map[string]string{row}, form.entityColumnHeaders)
 	}
 
 	if c.Settings != nil {
 		settingHeaders := map[string]struct{}{}
 		row, err := fieldsToRow(c.Settings, settingHeaders)
-		if err != nil {
-			return nil, err
-		}
+		errs.add(*c.Settings, err)
 		delete(row, "type")
 		delete(settingHeaders, "type")
-		orderedSettingColHeaders := getHeadersInOrder(settingHeaders, settingColumns)
-		settings := make([]string, len(orderedSettingColHeaders))
-		for k, v := range row {
-			settings[slices.Index(orderedSettingColHeaders, k)] = v
-		}
-		form.settingColumnHeaders = orderedSettingColHeaders
-		form.settings = [][]string{settings}
+		form.settingColumnHeaders = getHeadersInOrder(settingHeaders, settingColumns)
+		form.settings = rowsInOrder([]map[string]string{row}, form.settingColumnHeaders)
 	}
 
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return form, nil
 }
 
+// rowsInOrder lays out the cells of each row in the same order as headers
+func rowsInOrder(elements []map[string]string, headers []string) [][]string {
+	colIdx := headerIndex(headers)
+	rows := make([][]string, 0, len(elements))
+	for _, element := range elements {
+		row := make([]string, len(headers))
+		for key, val := range element {
+			row[colIdx[key]] = val
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// headerIndex maps each column header to its position so rows are laid out without searching
+// the headers for every cell
+func headerIndex(headers []string) map[string]int {
+	colIdx := make(map[string]int, len(headers))
+	for idx, header := range headers {
+		colIdx[header] = idx
+	}
+	return colIdx
+}
+
 type encodeState struct {
-	surveyColHeaders map[string]struct{}
-	choiceColHeaders map[string]struct{}
+	surveyColHeaders         map[string]struct{}
+	choiceColHeaders         map[string]struct{}
+	externalChoiceColHeaders map[string]struct{}
+	// rows of the lists that go to the external_choices sheet
+	externalChoices []map[string]string
+	// rows of the lists already added to each sheet keyed by list_name, questions can share a list
+	choiceLists         map[string][]map[string]string
+	externalChoiceLists map[string][]map[string]string
+	// csv files of the lists that are loaded from a file, keyed by file name
+	attachments map[string][]byte
 }
 
+// elementToRows adds the rows of a survey element and its children. It carries on past the
+// problems it finds so that they can all be reported at once
 func (e *encodeState) elementToRows(val *cue.Value, rows *[]map[string]string, choices *[]map[string]string) error {
+	errs := EncodeErrors{}
 	elementTypeVal := val.LookupPath(cue.ParsePath("type"))
+	if !elementTypeVal.Exists() {
+		errs.add(*val, fmt.Errorf("type: %w", ErrMissingField))
+		return errs
+	}
 	elementType, err := elementTypeVal.String()
 	if err != nil {
-		return err
+		errs.add(elementTypeVal, err)
+		return errs
 	}
 
 	row, err := fieldsToRow(val, e.surveyColHeaders)
-	if err != nil {
-		return err
-	}
+	errs.add(*val, err)
 	*rows = append(*rows, row)
 
-	if strings.HasPrefix(elementType, "select_") {
-		choiceStruct := val.LookupPath(cue.ParsePath("choices"))
-		c, err := choiceStructToRows(&choiceStruct, e.choiceColHeaders)
-		if err != nil {
-			return err
+	if choiceStruct := val.LookupPath(cue.ParsePath("choices")); strings.HasPrefix(elementType, "select_") && choiceStruct.Exists() {
+		if isFromFile(choiceStruct) {
+			errs.add(choiceStruct, e.addAttachment(&choiceStruct))
+		} else if external, _ := choiceStruct.LookupPath(cue.ParsePath("external")).Bool(); external {
+			c, err := choiceStructToRows(&choiceStruct, e.externalChoiceColHeaders)
+			if err == nil {
+				err = addChoiceList(e.externalChoiceLists, &e.externalChoices, c)
+			}
+			errs.add(choiceStruct, err)
+		} else {
+			c, err := choiceStructToRows(&choiceStruct, e.choiceColHeaders)
+			if err == nil {
+				err = addChoiceList(e.choiceLists, choices, c)
+			}
+			errs.add(choiceStruct, err)
 		}
-		*choices = append(*choices, c...)
 	}
 
 	if strings.HasPrefix(elementType, "begin_") {
@@ -142,53 +195,86 @@ func (e *encodeState) elementToRows(val *cue.Value, rows *[]map[string]string, c
 		if children.Exists() {
 			iter, err := getIter(&children)
 			if err != nil {
-				return err
+				errs.add(children, err)
 			}
-			for iter.Next() {
+			for err == nil && iter.Next() {
 				child := iter.Value()
-				e.elementToRows(&child, rows, choices)
+				errs.add(child, e.elementToRows(&child, rows, choices))
 			}
 		}
 		endTag := fmt.Sprintf("end_%s", strings.TrimPrefix(elementType, "begin_"))
 		*rows = append(*rows, map[string]string{"type": endTag})
 	}
+	return errs.err()
+}
+
+// addChoiceList appends the rows of a choice list unless a question that shares it already added
+// them. A list_name can only name one list, pyxform rejects duplicate list_name and name pairs
+func addChoiceList(added map[string][]map[string]string, choices *[]map[string]string, list []map[string]string) error {
+	if len(list) == 0 {
+		return nil
+	}
+	listName := list[0]["list_name"]
+	if rows, ok := added[listName]; ok {
+		if !reflect.DeepEqual(rows, list) {
+			return fmt.Errorf("%s: %w", listName, ErrConflictingChoices)
+		}
+		return nil
+	}
+	added[listName] = list
+	*choices = append(*choices, list...)
 	return nil
 }
 
+// fieldsToRow converts the fields of an element to the cells of its row, the row has every cell
+// we could convert even when some of them failed
 func fieldsToRow(val *cue.Value, keys map[string]struct{}) (map[string]string, error) {
+	result := map[string]string{}
 	elIter, err := val.Fields()
 	if err != nil {
-		return nil, err
+		return result, err
 	}
-	result := map[string]string{}
+	errs := EncodeErrors{}
 	for elIter.Next() {
 		key := elIter.Label()
 		if key == "children" || key == "choices" {
 			continue
 		}
-		if IsTranslatableColumn(key) {
+		if key == "media" {
+			errs.add(elIter.Value(), mediaToColumns(elIter.Value(), result, keys))
+		} else if IsTranslatableColumn(key) {
 			langsIter, err := elIter.Value().Fields()
 			if err != nil {
-				return nil, err
+				errs.add(elIter.Value(), err)
+				continue
 			}
 			for langsIter.Next() {
 				labelHeader := fmt.Sprintf("%s::%s", key, langsIter.Label())
 				result[labelHeader], err = langsIter.Value().String()
-				if err != nil {
-					return nil, err
-				}
+				errs.add(langsIter.Value(), err)
 				keys[labelHeader] = struct{}{}
 			}
 		} else {
-			keyVal, err := elIter.Value().String()
+			keyVal, err := ValueString(elIter.Value())
 			if err != nil {
-				return nil, err
+				errs.add(elIter.Value(), err)
+				continue
 			}
 			if key == "type" && strings.HasPrefix(keyVal, "select_") {
 				choiceStruct := val.LookupPath(cue.ParsePath("choices"))
-				listName, err := choiceStruct.LookupPath(cue.ParsePath("list_name")).String()
+				if !choiceStruct.Exists() {
+					errs.add(*val, fmt.Errorf("choices: %w", ErrMissingField))
+					continue
+				}
+				listNameVal := choiceStruct.LookupPath(cue.ParsePath("list_name"))
+				listName, err := listNameVal.String()
 				if err != nil {
-					return nil, err
+					errs.add(listNameVal, err)
+					continue
+				}
+				if isFromFile(choiceStruct) {
+					keyVal = fmt.Sprintf("%s_from_file", strings.TrimSuffix(keyVal, "_from_file"))
+					listName = fmt.Sprintf("%s.csv", listName)
 				}
 				result[key] = fmt.Sprintf("%s %s", keyVal, listName)
 			} else {
@@ -197,6 +283,65 @@ func fieldsToRow(val *cue.Value, keys map[string]struct{}) (map[string]string, e
 			keys[key] = struct{}{}
 		}
 	}
+	return result, errs.err()
+}
+
+// isChoiceList reports whether a top level value is a choice list and not a survey element
+func isChoiceList(val cue.Value) bool {
+	return val.LookupPath(cue.ParsePath("list_name")).Exists() && !val.LookupPath(cue.ParsePath("type")).Exists()
+}
+
+// isFromFile reports whether a choice list is loaded from a csv attachment instead of the choices sheet
+func isFromFile(choiceStruct cue.Value) bool {
+	fromFile, _ := choiceStruct.LookupPath(cue.ParsePath("from_file")).Bool()
+	return fromFile
+}
+
+// addAttachment writes a file backed choice list to <list_name>.csv. Lists with no choices are left
+// out so that we don't overwrite a file that is maintained outside the form
+func (e *encodeState) addAttachment(choiceStruct *cue.Value) error {
+	headers := map[string]struct{}{}
+	rows, err := choiceStructToRows(choiceStruct, headers)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	listName := rows[0]["list_name"]
+	delete(headers, "list_name")
+	for _, row := range rows {
+		delete(row, "list_name")
+	}
+	orderedHeaders := getHeadersInOrder(headers, choiceColumns)
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	if err := w.Write(orderedHeaders); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rowsInOrder(rows, orderedHeaders)); err != nil {
+		return err
+	}
+	e.attachments[fmt.Sprintf("%s.csv", listName)] = b.Bytes()
+	return nil
+}
+
+// entityToRow converts the entity declaration to a row of the entities sheet. Unlike survey rows
+// its label is an expression and not translated
+func entityToRow(val *cue.Value, keys map[string]struct{}) (map[string]string, error) {
+	elIter, err := val.Fields()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for elIter.Next() {
+		key := elIter.Label()
+		result[key], err = ValueString(elIter.Value())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		keys[key] = struct{}{}
+	}
 	return result, nil
 }
 
@@ -217,13 +362,29 @@ func choiceStructToRows(val *cue.Value, keys map[string]struct{}) ([]map[string]
 		if err != nil {
 			return nil, err
 		}
+		element := map[string]string{}
+		element["list_name"] = listName
+		keys["list_name"] = struct{}{}
 		for choiceIter.Next() {
 			key := choiceIter.Label()
-			element := map[string]string{}
-			element["list_name"] = listName
-			keys["list_name"] = struct{}{}
 			switch key {
 			case "filterCategory":
+				// any other choice sheet column e.g the ones used by choice_filter
+				columnsIter, err := choiceIter.Value().Fields()
+				if err != nil {
+					return nil, err
+				}
+				for columnsIter.Next() {
+					element[columnsIter.Label()], err = ValueString(columnsIter.Value())
+					if err != nil {
+						return nil, err
+					}
+					keys[columnsIter.Label()] = struct{}{}
+				}
+			case "media":
+				if err := mediaToColumns(choiceIter.Value(), element, keys); err != nil {
+					return nil, err
+				}
 			default:
 				element["name"] = key
 				keys["name"] = struct{}{}
@@ -240,35 +401,121 @@ func choiceStructToRows(val *cue.Value, keys map[string]struct{}) ([]map[string]
 					keys[labelKey] = struct{}{}
 				}
 			}
-			elements = append(elements, element)
 		}
+		elements = append(elements, element)
 	}
 	return elements, nil
 }
 
-func setDefaultColumnWidth(sheet string, f *excelize.File) {
-	f.SetColWidth(sheet, "A", "ZZ", 30)
+// mediaToColumns adds the media::<type>::<lang> columns of a media struct to row, media that is
+// the same in every language goes to a media::<type> column
+func mediaToColumns(val cue.Value, row map[string]string, keys map[string]struct{}) error {
+	mediaIter, err := val.Fields()
+	if err != nil {
+		return err
+	}
+	for mediaIter.Next() {
+		media := mediaIter.Label()
+		if mediaIter.Value().Kind() == cue.StringKind {
+			header := fmt.Sprintf("media::%s", media)
+			row[header], err = mediaIter.Value().String()
+			if err != nil {
+				return err
+			}
+			keys[header] = struct{}{}
+			continue
+		}
+		langsIter, err := mediaIter.Value().Fields()
+		if err != nil {
+			return err
+		}
+		for langsIter.Next() {
+			header := fmt.Sprintf("media::%s::%s", media, langsIter.Label())
+			row[header], err = langsIter.Value().String()
+			if err != nil {
+				return err
+			}
+			keys[header] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// setDefaultColumnWidth sets the widths of the columns up to ZZ, the survey label column is wider.
+// Ranges can't overlap in a stream so the survey is set around its label column
+func setDefaultColumnWidth(sw *excelize.StreamWriter, sheet string) error {
 	switch sheet {
-	case "survey":
-		f.SetColWidth(sheet, "C", "C", 50)
+	case surveySheetName:
+		if err := sw.SetColWidth(1, 2, 30); err != nil {
+			return err
+		}
+		if err := sw.SetColWidth(3, 3, 50); err != nil {
+			return err
+		}
+		return sw.SetColWidth(4, 702, 30)
+	default:
+		return sw.SetColWidth(1, 702, 30)
 	}
 }
 
-type Encoder struct{}
+type Encoder struct {
+	defaultLang string
+}
 
 func NewEncoder() *Encoder {
 	return &Encoder{}
 }
 
-// Encode returns XLSForm equivalent of the CUE file at filePath
-func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+// UseDefaultLang makes the encoder write the translatable columns of a form that is only in lang
+// without the language e.g label::English (en) becomes label
+func (encoder *Encoder) UseDefaultLang(lang string) {
+	encoder.defaultLang = lang
+}
+
+// toXLSForm parses the CUE file at filePath into an XLSForm struct
+func (encoder *Encoder) toXLSForm(filePath string) (*xlsForm, error) {
 	source, err := ParseCueForm(filePath)
 	if err != nil {
 		return nil, err
 	}
+	return encoder.formToXLSForm(source)
+}
+
+func (encoder *Encoder) formToXLSForm(source *CueForm) (*xlsForm, error) {
 	xlsform, err := source.toXLSForm()
 	if err != nil {
 		return nil, err
 	}
+	if encoder.defaultLang != "" {
+		xlsform.untranslateColumns(encoder.defaultLang)
+	}
+	return xlsform, nil
+}
+
+// EncodeAttachments returns the csv files of the choice lists in the CUE file at filePath that are
+// loaded from a file, keyed by file name. They go next to the encoded form
+func (encoder *Encoder) EncodeAttachments(filePath string) (map[string][]byte, error) {
+	xlsform, err := encoder.toXLSForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return xlsform.attachments, nil
+}
+
+// Encode returns XLSForm equivalent of the CUE file at filePath
+func (encoder *Encoder) Encode(filePath string) (*bytes.Buffer, error) {
+	xlsform, err := encoder.toXLSForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return xlsform.WriteToBuffer()
+}
+
+// EncodeForm returns the XLSForm equivalent of form
+func (encoder *Encoder) EncodeForm(form *CueForm) (*bytes.Buffer, error) {
+	xlsform, err := encoder.formToXLSForm(form)
+	if err != nil {
+		return nil, err
+	}
 	return xlsform.WriteToBuffer()
 }
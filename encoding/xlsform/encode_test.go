@@ -1,7 +1,12 @@
 package xlsform
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -48,6 +53,119 @@ func TestEncode(t *testing.T) {
 				},
 			},
 			err: nil,
+		}, {
+			// the form_select form split into a package
+			file: "testdata/package",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)"},
+				survey: [][]string{
+					{"text", "family_name", "What's your family name?"},
+					{"begin_group", "father", "Father"},
+					{"select_one ages", "age", "How old is your father?"},
+					{"end_group"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)"},
+				choices: [][]string{
+					{"ages", "over_30", "Over 30"},
+					{"ages", "over_40", "Over 40"},
+				},
+				settingColumnHeaders: []string{"form_title", "form_id", "default_language", "version"},
+				settings: [][]string{
+					{"test", "test_id", "English (en)", "1"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_shared_choices.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)"},
+				survey: [][]string{
+					{"select_one yes_no", "smokes", "Do you smoke?"},
+					{"select_one yes_no", "drinks", "Do you drink?"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)"},
+				choices: [][]string{
+					{"yes_no", "yes", "Yes"},
+					{"yes_no", "no", "No"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_choice_columns.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)", "choice_filter"},
+				survey: [][]string{
+					{"select_one county", "county", "County"},
+					{"select_one ward", "ward", "Ward", "county=${county}"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)", "code", "county"},
+				choices: [][]string{
+					{"county", "nairobi", "Nairobi"},
+					{"county", "mombasa", "Mombasa", "001"},
+					{"ward", "kilimani", "Kilimani", "", "nairobi"},
+					{"ward", "likoni", "Likoni", "", "mombasa"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_media.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)", "media::image::English (en)", "media::image::Swahili (sw)", "media::video"},
+				survey: [][]string{
+					{"select_one animals", "animal", "Which animal is this?", "animals.png", "wanyama.png", "animals.mp4"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)", "media::audio::English (en)", "media::audio::Swahili (sw)", "media::image"},
+				choices: [][]string{
+					{"animals", "cow", "Cow", "", "", "cow.png"},
+					{"animals", "goat", "Goat", "goat.mp3", "mbuzi.mp3"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_external.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)", "choice_filter"},
+				survey: [][]string{
+					{"select_one county", "county", "County"},
+					{"select_one_external ward", "ward", "Ward", "county=${county}"},
+				},
+				choiceColumnHeaders: []string{"list_name", "name", "label::English (en)"},
+				choices: [][]string{
+					{"county", "nairobi", "Nairobi"},
+				},
+				externalChoiceColumnHeaders: []string{"list_name", "name", "label::English (en)", "county"},
+				externalChoices: [][]string{
+					{"ward", "kilimani", "Kilimani", "nairobi"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_typed.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)", "required", "repeat_count", "read_only", "appearance", "default"},
+				survey: [][]string{
+					{"begin_repeat", "household", "Household", "", "3"},
+					{"integer", "members", "Members", "yes", "", "", "", "2"},
+					{"decimal", "income", "Income", "", "", "no", "", "2.5"},
+					{"end_repeat"},
+					{"text", "notes", "Notes", "", "", "", "multiline numbers"},
+				},
+			},
+			err: nil,
+		}, {
+			file: "testdata/form_entities.cue",
+			form: &xlsForm{
+				surveyColumnHeaders: []string{"type", "name", "label::English (en)", "save_to"},
+				survey: [][]string{
+					{"text", "species", "Tree species", "species"},
+					{"integer", "circumference", "Circumference (cm)", "circumference_cm"},
+				},
+				entityColumnHeaders: []string{"list_name", "label", "create_if"},
+				entities: [][]string{
+					{"trees", "concat(${species}, ' ', ${circumference})", "${circumference} > 0"},
+				},
+			},
+			err: nil,
 		},
 	}
 	for _, tc := range testCases {
@@ -67,3 +185,183 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDefaultLang(t *testing.T) {
+	testCases := []struct {
+		file    string
+		lang    string
+		headers map[string]string
+	}{
+		{
+			file: "testdata/form_select.cue",
+			lang: "English (en)",
+			headers: map[string]string{
+				"survey.csv":  "type,name,label",
+				"choices.csv": "list_name,name,label",
+			},
+		},
+		{
+			// not the language the form is in
+			file: "testdata/form_select.cue",
+			lang: "Swahili (sw)",
+			headers: map[string]string{
+				"survey.csv":  "type,name,label::English (en)",
+				"choices.csv": "list_name,name,label::English (en)",
+			},
+		},
+		{
+			// the media is in English and Swahili
+			file: "testdata/form_media.cue",
+			lang: "English (en)",
+			headers: map[string]string{
+				"survey.csv":  "type,name,label::English (en),media::image::English (en),media::image::Swahili (sw),media::video",
+				"choices.csv": "list_name,name,label::English (en),media::audio::English (en),media::audio::Swahili (sw),media::image",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file+tc.lang, func(t *testing.T) {
+			encoder := NewEncoder()
+			encoder.UseDefaultLang(tc.lang)
+			files, err := encoder.EncodeCSV(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for file, want := range tc.headers {
+				if have, _, _ := strings.Cut(string(files[file]), "\n"); have != want {
+					t.Fatalf("%s: have headers %q, want %q", file, have, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeAttachments(t *testing.T) {
+	encoder := NewEncoder()
+	f, err := encoder.Encode("testdata/form_from_file.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := parseXLSForm(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSurvey := [][]string{
+		{"select_one_from_file trees.csv", "tree", "Which tree?"},
+		{"select_multiple_from_file shrubs.csv", "shrubs", "Which shrubs?"},
+	}
+	if !reflect.DeepEqual(form.survey, wantSurvey) || form.choices != nil {
+		t.Fatalf("have survey %v and choices %v, want survey %v and no choices", form.survey, form.choices, wantSurvey)
+	}
+	attachments, err := encoder.EncodeAttachments("testdata/form_from_file.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"trees.csv": []byte("name,label::English (en),label::French (fr),region\noak,Oak,Chêne,north\nacacia,Acacia,,south\n"),
+	}
+	if !reflect.DeepEqual(attachments, want) {
+		t.Fatalf("have %q, want %q", attachments, want)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := NewEncoder().Encode("testdata/form_invalid.cue")
+	if !errors.Is(err, ErrMissingField) {
+		t.Fatalf("have %v, want %v", err, ErrMissingField)
+	}
+	var encodeErrs EncodeErrors
+	if !errors.As(err, &encodeErrs) {
+		t.Fatalf("have %T, want EncodeErrors", err)
+	}
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"form_invalid.cue:7:1: family_name: type: found survey element missing a required field",
+		"form_invalid.cue:11:1: age: choices: found survey element missing a required field",
+		`form_invalid.cue:24:11: father.children[0].label."English (en)": cannot use value 40 (type int) as string`,
+		"form_invalid.cue:30:14: father.children[1].relevant: cannot use value {age:40} (type struct) as string",
+	}
+	have := []string{}
+	for _, encodeErr := range encodeErrs {
+		have = append(have, strings.TrimPrefix(encodeErr.Error(), dir+string(filepath.Separator)))
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("have\n%s\nwant\n%s", strings.Join(have, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEncodeConflictingChoices(t *testing.T) {
+	_, err := NewEncoder().Encode("testdata/form_conflicting_choices.cue")
+	if !errors.Is(err, ErrConflictingChoices) {
+		t.Fatalf("have %v, want %v", err, ErrConflictingChoices)
+	}
+	if !strings.Contains(err.Error(), "drinks.choices: yes_no: ") {
+		t.Fatalf("error does not point at the second list: %v", err)
+	}
+}
+
+// largeChoicesForm writes a form with a select_one over n villages to a temporary file
+func largeChoicesForm(b *testing.B, n int) string {
+	var form strings.Builder
+	form.WriteString(`package main
+
+#Question: {...}
+#Choices: {...}
+
+village: #Question & {
+	type: "select_one"
+	name: "village"
+	label: "English (en)": "Village"
+	choices: #Choices & {
+		list_name: "village"
+		choices: [
+`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&form, "\t\t\t{village_%d: \"English (en)\": \"Village %d\"},\n", i, i)
+	}
+	form.WriteString("\t\t]\n\t}\n}\n")
+	file := filepath.Join(b.TempDir(), "form.cue")
+	if err := os.WriteFile(file, []byte(form.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	return file
+}
+
+func BenchmarkEncodeLargeChoices(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		file := largeChoicesForm(b, n)
+		b.Run(fmt.Sprintf("%d choices", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewEncoder().Encode(file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriteLargeChoices(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		sheets := largeChoicesSheets(n)
+		form := &xlsForm{
+			surveyColumnHeaders:         sheets["survey"][0],
+			survey:                      sheets["survey"][1:],
+			choiceColumnHeaders:         sheets["choices"][0],
+			choices:                     sheets["choices"][1:],
+			externalChoiceColumnHeaders: sheets["external_choices"][0],
+			externalChoices:             sheets["external_choices"][1:],
+		}
+		b.Run(fmt.Sprintf("%d choices", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := form.WriteToBuffer(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
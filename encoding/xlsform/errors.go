@@ -0,0 +1,163 @@
+package xlsform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// DecodeError is a problem found at a position in a sheet of the form. Row is the row number a
+// spreadsheet app shows, the header row being 1, and it's 0 when the problem is with the whole sheet
+type DecodeError struct {
+	Sheet  string
+	Row    int
+	Column string
+	Value  string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	b := strings.Builder{}
+	b.WriteString(e.Sheet)
+	if e.Row > 0 {
+		fmt.Fprintf(&b, ":%d", e.Row)
+	}
+	b.WriteString(": ")
+	if e.Column != "" {
+		b.WriteString(e.Column)
+		if e.Value != "" {
+			fmt.Fprintf(&b, " %q", e.Value)
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors are all the problems found in a form, in the order of the sheets and rows they are in
+type DecodeErrors []*DecodeError
+
+func (errs DecodeErrors) Error() string {
+	lines := make([]string, len(errs))
+	for idx, err := range errs {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs DecodeErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for idx, err := range errs {
+		unwrapped[idx] = err
+	}
+	return unwrapped
+}
+
+// add records a problem at row of sheet
+func (errs *DecodeErrors) add(sheet string, row int, column, value string, err error) {
+	*errs = append(*errs, &DecodeError{Sheet: sheet, Row: row, Column: column, Value: value, Err: err})
+}
+
+// collect keeps err if it's a DecodeError or a list of them, any other error is returned since
+// we can't carry on after it
+func (errs *DecodeErrors) collect(err error) error {
+	var decodeErrs DecodeErrors
+	var decodeErr *DecodeError
+	switch {
+	case err == nil:
+	case errors.As(err, &decodeErrs):
+		*errs = append(*errs, decodeErrs...)
+	case errors.As(err, &decodeErr):
+		*errs = append(*errs, decodeErr)
+	default:
+		return err
+	}
+	return nil
+}
+
+// err returns nil when no problem was found so that an empty list isn't mistaken for an error
+func (errs DecodeErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// EncodeError is a problem with a value of the CUE form, Path and Pos point at the offending field
+type EncodeError struct {
+	Path string
+	Pos  token.Pos
+	Err  error
+}
+
+func (e *EncodeError) Error() string {
+	b := strings.Builder{}
+	if e.Pos.IsValid() {
+		fmt.Fprintf(&b, "%s: ", e.Pos)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, "%s: ", e.Path)
+	}
+	if cueErr, ok := e.Err.(cueerrors.Error); ok {
+		// cue errors start with their own path which we already have
+		format, args := cueErr.Msg()
+		fmt.Fprintf(&b, format, args...)
+	} else {
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeErrors are all the problems found in a form, in the order of the elements they are in
+type EncodeErrors []*EncodeError
+
+func (errs EncodeErrors) Error() string {
+	lines := make([]string, len(errs))
+	for idx, err := range errs {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs EncodeErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for idx, err := range errs {
+		unwrapped[idx] = err
+	}
+	return unwrapped
+}
+
+// add records a problem with val, errors that already know where they are from are kept as is
+func (errs *EncodeErrors) add(val cue.Value, err error) {
+	var encodeErrs EncodeErrors
+	var encodeErr *EncodeError
+	switch {
+	case err == nil:
+	case errors.As(err, &encodeErrs):
+		*errs = append(*errs, encodeErrs...)
+	case errors.As(err, &encodeErr):
+		*errs = append(*errs, encodeErr)
+	default:
+		*errs = append(*errs, &EncodeError{Path: val.Path().String(), Pos: val.Pos(), Err: err})
+	}
+}
+
+// err returns nil when no problem was found so that an empty list isn't mistaken for an error
+func (errs EncodeErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
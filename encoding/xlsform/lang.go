@@ -0,0 +1,68 @@
+package xlsform
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// translateSheets gives the translatable columns that have no language the language lang e.g label
+// becomes label::lang. Only the label of the choice sheets is translatable, their other columns
+// are kept as they are
+func translateSheets(sheets map[string][][]string, lang string) map[string][][]string {
+	translated := maps.Clone(sheets)
+	for sheet, rows := range sheets {
+		if len(rows) == 0 {
+			continue
+		}
+		headers := slices.Clone(rows[0])
+		for idx, header := range headers {
+			switch {
+			case sheet == surveySheetName && slices.Contains(TranslatableCols, header):
+			case (sheet == choiceSheetName || sheet == externalChoiceSheetName) && header == "label":
+			default:
+				continue
+			}
+			headers[idx] = fmt.Sprintf("%s::%s", header, lang)
+		}
+		translated[sheet] = append([][]string{headers}, rows[1:]...)
+	}
+	return translated
+}
+
+// untranslateColumns writes the translatable and media columns of a form that only has lang as
+// plain columns e.g label::lang becomes label. Forms in more than one language are left as they are
+func (form *xlsForm) untranslateColumns(lang string) {
+	headers := [][]string{form.surveyColumnHeaders, form.choiceColumnHeaders, form.externalChoiceColumnHeaders}
+	for _, sheetHeaders := range headers {
+		for _, header := range sheetHeaders {
+			if headerLang, ok := columnLang(header); ok && headerLang != lang {
+				return
+			}
+		}
+	}
+	for _, sheetHeaders := range headers {
+		for idx, header := range sheetHeaders {
+			if _, ok := columnLang(header); ok {
+				sheetHeaders[idx] = strings.TrimSuffix(header, fmt.Sprintf("::%s", lang))
+			}
+		}
+	}
+}
+
+// columnLang returns the language of a translatable or media column
+func columnLang(header string) (string, bool) {
+	if IsMediaColumn(header) {
+		if _, lang, err := GetMediaFromCol(header); err == nil && lang != "" {
+			return lang, true
+		}
+		return "", false
+	}
+	if IsTranslatableColumn(header) {
+		if _, lang, err := GetLangFromCol(header); err == nil {
+			return lang, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,279 @@
+package xlsform
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+	odsTableNs  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNs   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	odsOfficeNs = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+
+	odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="application/vnd.oasis.opendocument.spreadsheet"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+)
+
+// EncodeODS returns the OpenDocument spreadsheet equivalent of the CUE file at filePath
+func (encoder *Encoder) EncodeODS(filePath string) (*bytes.Buffer, error) {
+	xlsform, err := encoder.toXLSForm(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return xlsform.writeODS()
+}
+
+// DecodeODS returns the CUE encoding of the OpenDocument spreadsheet in r
+func (d *Decoder) DecodeODS(r io.Reader) ([]byte, error) {
+	sheets, err := readODSSheets(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.DecodeSheets(sheets)
+}
+
+// readODSSheets reads the rows of the xlsform sheets in the ods file
+func readODSSheets(r io.Reader) (map[string][][]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)
+	}
+	content, err := archive.Open("content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)
+	}
+	defer content.Close()
+	return readODSContent(content)
+}
+
+// readODSContent reads the rows of every table in an ods content.xml. Like excelize's GetRows,
+// trailing empty cells and rows are dropped and repeated rows and cells are expanded. Blank cells
+// and rows are only expanded once something follows them since tables usually pad them out to
+// the maximum sheet size
+func readODSContent(r io.Reader) (map[string][][]string, error) {
+	sheets := map[string][][]string{}
+	decoder := xml.NewDecoder(r)
+	var (
+		table      string
+		rows       [][]string
+		blankRows  int
+		row        []string
+		rowRepeat  int
+		blankCells int
+		cell       *strings.Builder
+		cellCount  int
+		paragraph  int
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrInvalidXLSForm)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsTableNs && t.Name.Local == "table":
+				table, rows, blankRows = odsAttr(t, odsTableNs, "name"), [][]string{}, 0
+			case t.Name.Space == odsTableNs && t.Name.Local == "table-row":
+				row, rowRepeat, blankCells = []string{}, odsRepeat(t, "number-rows-repeated"), 0
+			case t.Name.Space == odsTableNs && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				cell, cellCount, paragraph = &strings.Builder{}, odsRepeat(t, "number-columns-repeated"), 0
+			case cell != nil && t.Name.Space == odsTextNs:
+				switch t.Name.Local {
+				case "p":
+					if paragraph > 0 {
+						cell.WriteString("\n")
+					}
+					paragraph++
+				case "s":
+					cell.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+				case "tab":
+					cell.WriteString("\t")
+				case "line-break":
+					cell.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if cell != nil && paragraph > 0 {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == odsTableNs && t.Name.Local == "table":
+				sheets[table] = rows
+			case t.Name.Space == odsTableNs && t.Name.Local == "table-row":
+				if len(row) == 0 {
+					blankRows += rowRepeat
+					continue
+				}
+				for ; blankRows > 0; blankRows-- {
+					rows = append(rows, []string{})
+				}
+				for i := 0; i < rowRepeat; i++ {
+					rows = append(rows, row)
+				}
+			case t.Name.Space == odsTableNs && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				if cell.Len() == 0 {
+					blankCells += cellCount
+				} else {
+					for ; blankCells > 0; blankCells-- {
+						row = append(row, "")
+					}
+					for i := 0; i < cellCount; i++ {
+						row = append(row, cell.String())
+					}
+				}
+				cell = nil
+			}
+		}
+	}
+	return sheets, nil
+}
+
+func odsAttr(t xml.StartElement, space, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func odsRepeat(t xml.StartElement, attr string) int {
+	space := odsTableNs
+	if attr == "c" {
+		space = odsTextNs
+	}
+	n, err := strconv.Atoi(odsAttr(t, space, attr))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// writeODS writes the form to an OpenDocument spreadsheet, each xlsform sheet is a table
+func (form *xlsForm) writeODS() (*bytes.Buffer, error) {
+	content := &bytes.Buffer{}
+	content.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(content, `<office:document-content xmlns:office=%q xmlns:table=%q xmlns:text=%q office:version="1.2"><office:body><office:spreadsheet>`, odsOfficeNs, odsTableNs, odsTextNs)
+	writeODSTable(content, surveySheetName, form.surveyColumnHeaders, form.survey)
+	if len(form.choices) > 0 {
+		writeODSTable(content, choiceSheetName, form.choiceColumnHeaders, form.choices)
+	}
+	if len(form.externalChoices) > 0 {
+		writeODSTable(content, externalChoiceSheetName, form.externalChoiceColumnHeaders, form.externalChoices)
+	}
+	if len(form.entities) > 0 {
+		writeODSTable(content, entitiesSheetName, form.entityColumnHeaders, form.entities)
+	}
+	if len(form.settings) > 0 {
+		writeODSTable(content, settingsSheetName, form.settingColumnHeaders, form.settings)
+	}
+	content.WriteString(`</office:spreadsheet></office:body></office:document-content>`)
+
+	b := &bytes.Buffer{}
+	w := zip.NewWriter(b)
+	// the mimetype has to be the first entry and it can't be compressed
+	mimeType, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mimeType.Write([]byte(odsMimeType)); err != nil {
+		return nil, err
+	}
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/manifest.xml", []byte(odsManifest)},
+		{"content.xml", content.Bytes()},
+	} {
+		f, err := w.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func writeODSTable(b *bytes.Buffer, sheet string, headers []string, rows [][]string) {
+	fmt.Fprintf(b, `<table:table table:name="%s">`, escapeXML(sheet))
+	for _, row := range append([][]string{headers}, rows...) {
+		b.WriteString("<table:table-row>")
+		for _, cell := range row {
+			if cell == "" {
+				b.WriteString("<table:table-cell/>")
+				continue
+			}
+			b.WriteString(`<table:table-cell office:value-type="string">`)
+			for _, p := range strings.Split(cell, "\n") {
+				fmt.Fprintf(b, "<text:p>%s</text:p>", odsText(p))
+			}
+			b.WriteString("</table:table-cell>")
+		}
+		b.WriteString("</table:table-row>")
+	}
+	b.WriteString("</table:table>")
+}
+
+// odsText escapes a paragraph of text. Consecutive spaces and tabs collapse in ODF so they are
+// written as text:s and text:tab elements
+func odsText(p string) string {
+	b := &strings.Builder{}
+	spaces := 0
+	flushSpaces := func() {
+		if spaces == 0 {
+			return
+		}
+		b.WriteString(" ")
+		if spaces > 1 {
+			fmt.Fprintf(b, `<text:s text:c="%d"/>`, spaces-1)
+		}
+		spaces = 0
+	}
+	for _, r := range p {
+		switch r {
+		case ' ':
+			spaces++
+			continue
+		case '\t':
+			flushSpaces()
+			b.WriteString("<text:tab/>")
+			continue
+		}
+		flushSpaces()
+		b.WriteString(escapeXML(string(r)))
+	}
+	flushSpaces()
+	return b.String()
+}
+
+func escapeXML(s string) string {
+	b := &bytes.Buffer{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
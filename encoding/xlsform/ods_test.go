@@ -0,0 +1,68 @@
+package xlsform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestODS(t *testing.T) {
+	want := &xlsForm{
+		surveyColumnHeaders: []string{"type", "name", "label::English (en)"},
+		survey: [][]string{
+			{"text", "family_name", "What's your family name?"},
+			{"begin_group", "father", "Father"},
+			{"select_one ages", "age", "How old is your father?"},
+			{"end_group"},
+		},
+		choiceColumnHeaders: []string{"list_name", "name", "label::English (en)"},
+		choices: [][]string{
+			{"ages", "over_30", "Over 30"},
+			{"ages", "over_40", "Over 40"},
+		},
+		settingColumnHeaders: []string{"form_title", "form_id", "default_language", "version"},
+		settings: [][]string{
+			{"test", "test_id", "English (en)", "1"},
+		},
+	}
+	b, err := NewEncoder().EncodeODS("testdata/form_select.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets, err := readODSSheets(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := parseSheets(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Fatalf("have\n%+v\nbut want\n%+v", form, want)
+	}
+}
+
+func TestReadODSContent(t *testing.T) {
+	content := `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet><table:table table:name="survey">
+<table:table-row><table:table-cell><text:p>type</text:p></table:table-cell><table:table-cell table:number-columns-repeated="2"/><table:table-cell><text:p>label::English (en)</text:p></table:table-cell><table:table-cell table:number-columns-repeated="1020"/></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+<table:table-row><table:table-cell><text:p>note</text:p></table:table-cell><table:table-cell table:number-columns-repeated="2"/><table:table-cell><text:p>two<text:s text:c="2"/>spaces</text:p><text:p>and a line</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table></office:spreadsheet></office:body></office:document-content>`
+	want := map[string][][]string{
+		"survey": {
+			{"type", "", "", "label::English (en)"},
+			{},
+			{},
+			{"note", "", "", "two  spaces\nand a line"},
+		},
+	}
+	have, err := readODSContent(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("have\n%q\nbut want\n%q", have, want)
+	}
+}
@@ -0,0 +1,82 @@
+package xlsform
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CellDiff is a cell whose value is not the same in two workbooks of a form
+type CellDiff struct {
+	Sheet string
+	// Row is the row number in the sheet, the headers are row 1
+	Row    int
+	Column string
+	Want   string
+	Have   string
+}
+
+func (diff CellDiff) String() string {
+	return fmt.Sprintf("%s row %d column %s: have %q, want %q", diff.Sheet, diff.Row, diff.Column, diff.Have, diff.Want)
+}
+
+// RoundTrip decodes workbook, encodes the form it decodes to and returns the cells that did not
+// survive the trip
+func RoundTrip(decoder *Decoder, encoder *Encoder, workbook []byte) ([]CellDiff, error) {
+	form, err := decoder.DecodeCueForm(bytes.NewReader(workbook))
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	encoded, err := encoder.EncodeForm(form)
+	if err != nil {
+		return nil, fmt.Errorf("encode: %w", err)
+	}
+	return CompareWorkbooks(workbook, encoded.Bytes())
+}
+
+// CompareWorkbooks compares the xlsform sheets of two workbooks cell by cell. Columns are matched
+// by their header so the order they are in doesn't matter, a column or row that is only in one of
+// the workbooks differs wherever it has a value
+func CompareWorkbooks(want, have []byte) ([]CellDiff, error) {
+	wantForm, err := parseXLSForm(bytes.NewReader(want))
+	if err != nil {
+		return nil, err
+	}
+	haveForm, err := parseXLSForm(bytes.NewReader(have))
+	if err != nil {
+		return nil, err
+	}
+	diffs := compareSheet(surveySheetName, wantForm.surveyColumnHeaders, wantForm.survey, haveForm.surveyColumnHeaders, haveForm.survey)
+	diffs = append(diffs, compareSheet(choiceSheetName, wantForm.choiceColumnHeaders, wantForm.choices, haveForm.choiceColumnHeaders, haveForm.choices)...)
+	diffs = append(diffs, compareSheet(externalChoiceSheetName, wantForm.externalChoiceColumnHeaders, wantForm.externalChoices, haveForm.externalChoiceColumnHeaders, haveForm.externalChoices)...)
+	diffs = append(diffs, compareSheet(entitiesSheetName, wantForm.entityColumnHeaders, wantForm.entities, haveForm.entityColumnHeaders, haveForm.entities)...)
+	diffs = append(diffs, compareSheet(settingsSheetName, wantForm.settingColumnHeaders, wantForm.settings, haveForm.settingColumnHeaders, haveForm.settings)...)
+	return diffs, nil
+}
+
+func compareSheet(sheet string, wantHeaders []string, wantRows [][]string, haveHeaders []string, haveRows [][]string) []CellDiff {
+	wantIdx, haveIdx := headerIndex(wantHeaders), headerIndex(haveHeaders)
+	columns := appendUnique(nil, append(append([]string{}, wantHeaders...), haveHeaders...)...)
+	rows := len(wantRows)
+	if len(haveRows) > rows {
+		rows = len(haveRows)
+	}
+	diffs := []CellDiff{}
+	for rowIdx := 0; rowIdx < rows; rowIdx++ {
+		for _, column := range columns {
+			wantCell, haveCell := sheetCell(wantIdx, wantRows, rowIdx, column), sheetCell(haveIdx, haveRows, rowIdx, column)
+			if wantCell != haveCell {
+				diffs = append(diffs, CellDiff{Sheet: sheet, Row: rowIdx + 2, Column: column, Want: wantCell, Have: haveCell})
+			}
+		}
+	}
+	return diffs
+}
+
+// sheetCell returns the value of column in the row at rowIdx, cells that are not there are empty
+func sheetCell(colIdx map[string]int, rows [][]string, rowIdx int, column string) string {
+	idx, ok := colIdx[column]
+	if !ok || rowIdx >= len(rows) {
+		return ""
+	}
+	return cellValue(rows[rowIdx], idx)
+}
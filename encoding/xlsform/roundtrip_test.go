@@ -0,0 +1,84 @@
+package xlsform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareWorkbooks(t *testing.T) {
+	want := &xlsForm{
+		surveyColumnHeaders: []string{"type", "name", "label::English (en)"},
+		survey: [][]string{
+			{"text", "family_name", "What's your family name?"},
+			{"integer", "age", "How old are you?"},
+		},
+	}
+	// the same form with its columns in another order, a changed label and an extra row
+	have := &xlsForm{
+		surveyColumnHeaders: []string{"name", "label::English (en)", "type"},
+		survey: [][]string{
+			{"family_name", "What's your family name?", "text"},
+			{"age", "How old?", "integer"},
+			{"notes", "", "text"},
+		},
+	}
+	wantBuf, err := want.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	haveBuf, err := have.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := CompareWorkbooks(wantBuf.Bytes(), haveBuf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDiffs := []CellDiff{
+		{Sheet: surveySheetName, Row: 3, Column: "label::English (en)", Want: "How old are you?", Have: "How old?"},
+		{Sheet: surveySheetName, Row: 4, Column: "type", Want: "", Have: "text"},
+		{Sheet: surveySheetName, Row: 4, Column: "name", Want: "", Have: "notes"},
+	}
+	if !reflect.DeepEqual(diffs, wantDiffs) {
+		t.Fatalf("have\n%v\nwant\n%v", diffs, wantDiffs)
+	}
+	if have := diffs[0].String(); have != `survey row 3 column label::English (en): have "How old?", want "How old are you?"` {
+		t.Fatalf("have %s", have)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/form*.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workbooks := map[string][]byte{}
+	for _, file := range files {
+		if file == "testdata/form_invalid.cue" || file == "testdata/form_conflicting_choices.cue" {
+			continue
+		}
+		b, err := NewEncoder().Encode(file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		workbooks[file] = b.Bytes()
+	}
+	if workbooks["testdata/valid.xlsx"], err = os.ReadFile("testdata/valid.xlsx"); err != nil {
+		t.Fatal(err)
+	}
+	// the decoded forms import the schema so they are encoded from its module
+	t.Chdir("../../schema")
+	for file, workbook := range workbooks {
+		t.Run(file, func(t *testing.T) {
+			diffs, err := RoundTrip(NewDecoder("github.com/freddieptf/cueform/xlsform"), NewEncoder(), workbook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, diff := range diffs {
+				t.Error(diff)
+			}
+		})
+	}
+}
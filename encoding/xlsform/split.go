@@ -0,0 +1,319 @@
+package xlsform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/ast/astutil"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
+)
+
+const (
+	formFileName     = "form.cue"
+	choicesFileName  = "choices.cue"
+	settingsFileName = "settings.cue"
+	entitiesFileName = "entities.cue"
+)
+
+var (
+	identRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	// cueKeywords can't be used to refer to a field
+	cueKeywords = map[string]struct{}{
+		"package": {}, "import": {}, "for": {}, "in": {}, "if": {}, "let": {}, "true": {}, "false": {}, "null": {}, "_": {},
+	}
+)
+
+// SplitPackage splits a decoded form into the files of a CUE package. Every top level group gets its
+// own file, the choice lists are declared once in choices.cue and the questions refer to them, and
+// form.cue has the questions that are not in a group along with the order of the survey since CUE
+// orders the fields of a package by the files they are in
+func SplitPackage(src []byte) (map[string][]byte, error) {
+	file, err := parser.ParseFile(formFileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := nameChoiceLists(file)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pkg     *ast.Package
+		imports []*ast.ImportDecl
+	)
+	files := map[string][]ast.Decl{}
+	for _, decl := range file.Decls {
+		switch v := decl.(type) {
+		case *ast.Package:
+			pkg = v
+		case *ast.ImportDecl:
+			imports = append(imports, v)
+		case *ast.Field:
+			name, _, err := ast.LabelName(v.Label)
+			if err != nil {
+				return nil, err
+			}
+			fileName := formFileName
+			switch {
+			case name == "form_settings":
+				fileName = settingsFileName
+			case name == "form_entities":
+				fileName = entitiesFileName
+			case isChoiceListExpr(v.Value):
+				fileName = choicesFileName
+			default:
+				if begin, _ := groupEdge(elementType(v.Value)); begin {
+					// the group is declared in its own file but keeps its place in the survey
+					fileName = groupFileName(name, files)
+					files[formFileName] = append(files[formFileName], &ast.Field{Label: v.Label, Value: ast.NewIdent("_")})
+				}
+			}
+			files[fileName] = append(files[fileName], v)
+		}
+	}
+	for _, list := range lists {
+		files[choicesFileName] = append(files[choicesFileName], list)
+	}
+	result := map[string][]byte{}
+	for fileName, decls := range files {
+		out := &ast.File{}
+		if pkg != nil {
+			out.Decls = append(out.Decls, pkg)
+		}
+		for _, importDecl := range imports {
+			if specs := usedImports(importDecl, decls); len(specs) > 0 {
+				out.Decls = append(out.Decls, &ast.ImportDecl{Specs: specs})
+			}
+		}
+		out.Decls = append(out.Decls, decls...)
+		b, err := format.Node(out, format.Simplify())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		result[fileName] = b
+	}
+	return result, nil
+}
+
+// nameChoiceLists declares every choice list of the survey once as a top level field and makes the
+// questions refer to it. It returns the new fields in the order the lists are first used
+func nameChoiceLists(file *ast.File) ([]*ast.Field, error) {
+	namer := &listNamer{taken: map[string]struct{}{}, lists: map[string]string{}, exprs: map[string]ast.Expr{}}
+	elements := []ast.Expr{}
+	for _, decl := range file.Decls {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		name, _, err := ast.LabelName(field.Label)
+		if err != nil {
+			return nil, err
+		}
+		namer.taken[name] = struct{}{}
+		if isChoiceListExpr(field.Value) {
+			// already declared at the top
+			namer.lists[choiceListName(field.Value)] = name
+			namer.exprs[choiceListName(field.Value)] = field.Value
+			continue
+		}
+		if name == "form_settings" || name == "form_entities" {
+			continue
+		}
+		elements = append(elements, field.Value)
+		// a reference resolves to the closest field with its name so no list can share the name
+		// of a field of a survey element
+		ast.Walk(field.Value, func(n ast.Node) bool {
+			f, ok := n.(*ast.Field)
+			if !ok {
+				return true
+			}
+			if label, _, err := ast.LabelName(f.Label); err == nil {
+				namer.taken[label] = struct{}{}
+				return label != "choices"
+			}
+			return true
+		}, nil)
+	}
+	for _, element := range elements {
+		if err := namer.hoist(element); err != nil {
+			return nil, err
+		}
+	}
+	return namer.fields, nil
+}
+
+type listNamer struct {
+	taken map[string]struct{}
+	// identifiers of the lists we've named, keyed by list_name
+	lists map[string]string
+	exprs map[string]ast.Expr
+	// the new top level fields
+	fields []*ast.Field
+}
+
+// hoist replaces the choices of element and the elements in its children with references to the
+// top level list fields
+func (n *listNamer) hoist(element ast.Expr) error {
+	body := elementStruct(element)
+	if body == nil {
+		return nil
+	}
+	for _, decl := range body.Elts {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		switch label, _, _ := ast.LabelName(field.Label); label {
+		case "choices":
+			if !isChoiceListExpr(field.Value) {
+				continue
+			}
+			ident, err := n.name(field.Value)
+			if err != nil {
+				return err
+			}
+			field.Value = ast.NewIdent(ident)
+		case "children":
+			children, ok := field.Value.(*ast.ListLit)
+			if !ok {
+				continue
+			}
+			for _, child := range children.Elts {
+				if err := n.hoist(child); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// name returns the identifier of the top level field of a choice list, adding the field the first
+// time we see the list
+func (n *listNamer) name(expr ast.Expr) (string, error) {
+	listName := choiceListName(expr)
+	if ident, ok := n.lists[listName]; ok {
+		if !sameExpr(n.exprs[listName], expr) {
+			return "", fmt.Errorf("%s: %w", listName, ErrConflictingChoices)
+		}
+		return ident, nil
+	}
+	ident := identRe.ReplaceAllString(listName, "_")
+	if ident == "" || ident[0] >= '0' && ident[0] <= '9' {
+		ident = "list_" + ident
+	}
+	if n.isTaken(ident) {
+		ident = ident + "_choices"
+	}
+	for i, base := 2, ident; n.isTaken(ident); i++ {
+		ident = base + strconv.Itoa(i)
+	}
+	n.taken[ident] = struct{}{}
+	n.lists[listName] = ident
+	n.exprs[listName] = expr
+	n.fields = append(n.fields, &ast.Field{Label: ast.NewIdent(ident), Value: expr})
+	return ident, nil
+}
+
+func (n *listNamer) isTaken(ident string) bool {
+	_, taken := n.taken[ident]
+	_, keyword := cueKeywords[ident]
+	return taken || keyword
+}
+
+// elementStruct returns the struct of a survey element declared as pkg.#Question & {...} or {...}
+func elementStruct(expr ast.Expr) *ast.StructLit {
+	switch v := expr.(type) {
+	case *ast.StructLit:
+		return v
+	case *ast.BinaryExpr:
+		if s := elementStruct(v.Y); s != nil {
+			return s
+		}
+		return elementStruct(v.X)
+	}
+	return nil
+}
+
+// lookupString returns the string value of the field label in the struct of expr
+func lookupString(expr ast.Expr, label string) string {
+	body := elementStruct(expr)
+	if body == nil {
+		return ""
+	}
+	for _, decl := range body.Elts {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		if name, _, _ := ast.LabelName(field.Label); name != label {
+			continue
+		}
+		if lit, ok := field.Value.(*ast.BasicLit); ok {
+			if value, err := literal.Unquote(lit.Value); err == nil {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func elementType(expr ast.Expr) string {
+	return lookupString(expr, "type")
+}
+
+func choiceListName(expr ast.Expr) string {
+	return lookupString(expr, "list_name")
+}
+
+// isChoiceListExpr reports whether expr declares a choice list rather than a survey element
+func isChoiceListExpr(expr ast.Expr) bool {
+	return choiceListName(expr) != "" && elementType(expr) == ""
+}
+
+func sameExpr(a, b ast.Expr) bool {
+	x, errX := format.Node(a)
+	y, errY := format.Node(b)
+	return errX == nil && errY == nil && string(x) == string(y)
+}
+
+// groupFileName names the file of a top level group after it, making sure it doesn't take the
+// name of one of the other files of the package
+func groupFileName(name string, files map[string][]ast.Decl) string {
+	fileName := fmt.Sprintf("%s.cue", name)
+	for _, ok := files[fileName]; ok || fileName == formFileName || fileName == choicesFileName || fileName == settingsFileName || fileName == entitiesFileName; _, ok = files[fileName] {
+		name = name + "_group"
+		fileName = fmt.Sprintf("%s.cue", name)
+	}
+	return fileName
+}
+
+// usedImports returns the import specs of importDecl that decls refer to, CUE doesn't allow
+// unused imports
+func usedImports(importDecl *ast.ImportDecl, decls []ast.Decl) []*ast.ImportSpec {
+	specs := []*ast.ImportSpec{}
+	for _, spec := range importDecl.Specs {
+		info, err := astutil.ParseImportSpec(spec)
+		if err != nil {
+			continue
+		}
+		used := false
+		for _, decl := range decls {
+			ast.Walk(decl, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == info.Ident {
+						used = true
+					}
+				}
+				return !used
+			}, nil)
+		}
+		if used {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
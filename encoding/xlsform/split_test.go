@@ -0,0 +1,113 @@
+package xlsform
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const splitForm = `package main
+
+import "github.com/freddieptf/cueform/xlsform"
+
+family_name: xlsform.#Question & {
+	type: "select_one"
+	name: "family_name"
+	label: "English (en)": "What's your family name?"
+	choices: xlsform.#Choices & {
+		list_name: "names"
+		choices: [{smith: "English (en)": "Smith"}]
+	}
+}
+father: xlsform.#Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		xlsform.#Question & {
+			type: "select_one"
+			name: "name"
+			label: "English (en)": "What's his name?"
+			choices: xlsform.#Choices & {
+				list_name: "names"
+				choices: [{smith: "English (en)": "Smith"}]
+			}
+		},
+		xlsform.#Question & {
+			type: "select_one"
+			name: "age"
+			label: "English (en)": "How old is he?"
+			choices: xlsform.#Choices & {
+				list_name: "1-age"
+				choices: [{over_30: "English (en)": "Over 30"}]
+			}
+		},
+	]
+}
+form_settings: xlsform.#Settings & {
+	type:       "settings"
+	form_title: "test"
+	form_id:    "test_id"
+}
+`
+
+func TestSplitPackage(t *testing.T) {
+	files, err := SplitPackage([]byte(splitForm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"choices.cue", "father.cue", "form.cue", "settings.cue"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("have files %v, want %v", names, want)
+	}
+	testCases := []struct {
+		file string
+		want []string
+	}{
+		{
+			file: "form.cue",
+			want: []string{"package main", `import "github.com/freddieptf/cueform/xlsform"`, "choices: names", "father: _"},
+		},
+		{
+			file: "father.cue",
+			want: []string{"package main", "choices: names", "choices: list_1_age"},
+		},
+		{
+			file: "choices.cue",
+			want: []string{"names:", "list_1_age:", `list_name: "1-age"`},
+		},
+		{
+			file: "settings.cue",
+			want: []string{"form_settings:", `form_id:    "test_id"`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			content := string(files[tc.file])
+			for _, want := range tc.want {
+				if !strings.Contains(content, want) {
+					t.Fatalf("%s is missing %q\n%s", tc.file, want, content)
+				}
+			}
+		})
+	}
+	// the list used twice is only declared once
+	if count := strings.Count(string(files["choices.cue"]), `list_name: "names"`); count != 1 {
+		t.Fatalf("have names declared %d times, want once", count)
+	}
+}
+
+func TestSplitPackageConflictingChoices(t *testing.T) {
+	form := strings.Replace(splitForm, `{smith: "English (en)": "Smith"}]
+			}`, `{jones: "English (en)": "Jones"}]
+			}`, 1)
+	if _, err := SplitPackage([]byte(form)); !errors.Is(err, ErrConflictingChoices) {
+		t.Fatalf("have %v, want %v", err, ErrConflictingChoices)
+	}
+}
@@ -0,0 +1,218 @@
+package xlsform
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// validationSheetName is the hidden sheet that holds the values of the dropdowns, the decoder
+	// and pyxform skip sheets they don't know about
+	validationSheetName = "validation_lists"
+
+	groupColor  = "#DDEBF7"
+	repeatColor = "#FCE4D6"
+	// maxOutlineLevel is the deepest row outline excel supports
+	maxOutlineLevel = 7
+)
+
+var (
+	// questionTypes are the types of #QuestionType in the xlsform schema, TestQuestionTypes keeps
+	// them in step
+	questionTypes = []string{"select_one", "select_multiple", "select_one_from_file", "select_multiple_from_file", "select_one_external",
+		"rank", "text", "integer", "decimal", "date", "time", "dateTime", "geopoint", "image", "audio", "background-audio", "video", "file", "note",
+		"barcode", "acknowledge", "calculate", "geotrace", "geoshape"}
+	groupTypes  = []string{"begin_group", "end_group", "begin_repeat", "end_repeat"}
+	selectTypes = []string{"select_one", "select_multiple", "rank"}
+	appearances = []string{"minimal", "quick", "autocomplete", "horizontal", "horizontal-compact", "compact", "columns", "columns-pack",
+		"likert", "label", "list-nolabel", "list", "field-list", "table-list", "multiline", "numbers", "thousands-sep", "no-calendar",
+		"month-year", "year", "signature", "draw", "annotate", "new", "maps", "placement-map", "quick-compact"}
+)
+
+// dropdown is a data validation list for a column, its values are kept in valuesCol of the
+// validation sheet
+type dropdown struct {
+	sheet     string
+	column    string
+	col       string
+	valuesCol string
+	values    []string
+}
+
+// workbookStyles are the styles the generated workbook is written with. Header rows are bold
+// and frozen, groups and repeats are outlined and coloured, and the columns with a known set of
+// values get a dropdown, all of which makes the workbook safer to edit by hand
+type workbookStyles struct {
+	header int
+	group  int
+	repeat int
+}
+
+func newWorkbookStyles(f *excelize.File) (*workbookStyles, error) {
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{groupColor}}})
+	if err != nil {
+		return nil, err
+	}
+	repeat, err := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{repeatColor}}})
+	if err != nil {
+		return nil, err
+	}
+	return &workbookStyles{header: header, group: group, repeat: repeat}, nil
+}
+
+// surveyRowOpts nests the rows of a group or repeat under its begin and end rows, and colours
+// those so that it's easy to see where each starts and stops
+func (form *xlsForm) surveyRowOpts(styles *workbookStyles) []excelize.RowOpts {
+	typeIdx := slices.Index(form.surveyColumnHeaders, "type")
+	rowOpts := make([]excelize.RowOpts, len(form.survey))
+	depth := 0
+	for idx, row := range form.survey {
+		if typeIdx == -1 || typeIdx >= len(row) {
+			continue
+		}
+		elementType := strings.ReplaceAll(row[typeIdx], " ", "_")
+		if strings.HasPrefix(elementType, "end_") && depth > 0 {
+			depth--
+		}
+		rowOpts[idx].OutlineLevel = depth
+		if depth > maxOutlineLevel {
+			rowOpts[idx].OutlineLevel = maxOutlineLevel
+		}
+		switch elementType {
+		case "begin_group", "end_group":
+			rowOpts[idx].StyleID = styles.group
+		case "begin_repeat", "end_repeat":
+			rowOpts[idx].StyleID = styles.repeat
+		}
+		if strings.HasPrefix(elementType, "begin_") {
+			depth++
+		}
+	}
+	return rowOpts
+}
+
+// dropdowns lists the data validations of the sheets and the validation sheet column that
+// holds the values of each
+func (form *xlsForm) dropdowns(sheets []sheet) []dropdown {
+	choiceLists := listNames(form.choiceColumnHeaders, form.choices)
+	externalLists := listNames(form.externalChoiceColumnHeaders, form.externalChoices)
+	types := append(slices.Clone(questionTypes), groupTypes...)
+	for _, list := range choiceLists {
+		for _, selectType := range selectTypes {
+			types = append(types, fmt.Sprintf("%s %s", selectType, list))
+		}
+	}
+	for _, list := range externalLists {
+		types = append(types, fmt.Sprintf("select_one_external %s", list))
+	}
+	// keep the types already in use e.g the ones of lists loaded from a file
+	types = appendUnique(types, columnValues(form.surveyColumnHeaders, form.survey, "type")...)
+	// typed forms write required as an xpath bool, and it can be any xpath expression
+	required := appendUnique([]string{"yes", "no", "true()", "false()"}, columnValues(form.surveyColumnHeaders, form.survey, "required")...)
+	candidates := []dropdown{
+		{sheet: surveySheetName, column: "type", values: types},
+		{sheet: surveySheetName, column: "required", values: required},
+		{sheet: surveySheetName, column: "appearance", values: appearances},
+		{sheet: choiceSheetName, column: "list_name", values: choiceLists},
+		{sheet: externalChoiceSheetName, column: "list_name", values: externalLists},
+	}
+	dropdowns := []dropdown{}
+	for _, d := range candidates {
+		sheetIdx := slices.IndexFunc(sheets, func(s sheet) bool { return s.name == d.sheet })
+		if sheetIdx == -1 || len(d.values) == 0 {
+			continue
+		}
+		colIdx := slices.Index(sheets[sheetIdx].headers, d.column)
+		if colIdx == -1 {
+			continue
+		}
+		d.col, _ = excelize.ColumnNumberToName(colIdx + 1)
+		d.valuesCol, _ = excelize.ColumnNumberToName(len(dropdowns) + 1)
+		dropdowns = append(dropdowns, d)
+	}
+	return dropdowns
+}
+
+// validation only warns about values that are not in the list since xlsform allows more than we
+// can list e.g metadata types and appearance combinations
+func (d dropdown) validation() *excelize.DataValidation {
+	dv := excelize.NewDataValidation(true)
+	dv.Sqref = fmt.Sprintf("%s2:%s%d", d.col, d.col, excelize.TotalRows)
+	dv.SetSqrefDropList(fmt.Sprintf("%s!$%s$1:$%s$%d", validationSheetName, d.valuesCol, d.valuesCol, len(d.values)))
+	dv.SetError(excelize.DataValidationErrorStyleWarning, fmt.Sprintf("Unknown %s", d.column), fmt.Sprintf("This is not one of the %s values we know of", d.column))
+	return dv
+}
+
+// writeDropdownValues writes the values of each dropdown into its column of the hidden
+// validation sheet, which has to exist already. The decoder and pyxform skip sheets they don't know about
+func writeDropdownValues(f *excelize.File, dropdowns []dropdown) error {
+	if len(dropdowns) == 0 {
+		return nil
+	}
+	sw, err := f.NewStreamWriter(validationSheetName)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	for _, d := range dropdowns {
+		if len(d.values) > rows {
+			rows = len(d.values)
+		}
+	}
+	for rowIdx := 0; rowIdx < rows; rowIdx++ {
+		row := make([]interface{}, len(dropdowns))
+		for colIdx, d := range dropdowns {
+			if rowIdx < len(d.values) {
+				row[colIdx] = d.values[rowIdx]
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, rowIdx+1)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
+
+// listNames returns the list names in a choices sheet in the order they first appear
+func listNames(headers []string, rows [][]string) []string {
+	return appendUnique(nil, columnValues(headers, rows, "list_name")...)
+}
+
+func columnValues(headers []string, rows [][]string, column string) []string {
+	colIdx := slices.Index(headers, column)
+	values := []string{}
+	if colIdx == -1 {
+		return values
+	}
+	for _, row := range rows {
+		if colIdx < len(row) && row[colIdx] != "" {
+			values = append(values, row[colIdx])
+		}
+	}
+	return values
+}
+
+func appendUnique(list []string, values ...string) []string {
+	seen := make(map[string]struct{}, len(list))
+	for _, value := range list {
+		seen[value] = struct{}{}
+	}
+	for _, value := range values {
+		if _, ok := seen[value]; !ok {
+			seen[value] = struct{}{}
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+package xlsform
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/load"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestStyleWorkbook(t *testing.T) {
+	b, err := NewEncoder().Encode("testdata/form_select.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, sheet := range []string{surveySheetName, choiceSheetName, settingsSheetName} {
+		panes, err := f.GetPanes(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !panes.Freeze || panes.YSplit != 1 {
+			t.Fatalf("%s: header row is not frozen %+v", sheet, panes)
+		}
+	}
+	if visible, err := f.GetSheetVisible(validationSheetName); err != nil || visible {
+		t.Fatalf("want hidden %s sheet, have visible %t err %v", validationSheetName, visible, err)
+	}
+
+	// the survey rows are family_name, begin_group, age and end_group
+	levels := []uint8{}
+	for row := 2; row <= 5; row++ {
+		level, err := f.GetRowOutlineLevel(surveySheetName, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels = append(levels, level)
+	}
+	if want := []uint8{0, 0, 1, 0}; !reflect.DeepEqual(levels, want) {
+		t.Fatalf("have outline levels %v, want %v", levels, want)
+	}
+
+	testCases := []struct {
+		sheet string
+		sqref string
+	}{
+		{sheet: surveySheetName, sqref: "A2:A1048576"},
+		{sheet: choiceSheetName, sqref: "A2:A1048576"},
+	}
+	for _, tc := range testCases {
+		validations, err := f.GetDataValidations(tc.sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(validations) != 1 || validations[0].Sqref != tc.sqref {
+			t.Fatalf("%s: have validations %+v, want one on %s", tc.sheet, validations, tc.sqref)
+		}
+	}
+	cols, err := f.GetCols(validationSheetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 {
+		t.Fatalf("have %d dropdown lists, want 2", len(cols))
+	}
+	for _, want := range []string{"text", "begin_group", "select_one ages", "select_multiple ages", "rank ages"} {
+		if !slices.Contains(cols[0], want) {
+			t.Fatalf("type dropdown is missing %q", want)
+		}
+	}
+	if lists := slices.DeleteFunc(cols[1], func(s string) bool { return s == "" }); !reflect.DeepEqual(lists, []string{"ages"}) {
+		t.Fatalf("have list_name dropdown %v, want [ages]", lists)
+	}
+
+	// the decoder doesn't see the styling or the extra sheet
+	b, err = NewEncoder().Encode("testdata/form_select.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := parseXLSForm(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"ages", "over_30", "Over 30"}, {"ages", "over_40", "Over 40"}}; !reflect.DeepEqual(form.choices, want) {
+		t.Fatalf("have choices %v, want %v", form.choices, want)
+	}
+}
+
+func TestQuestionTypes(t *testing.T) {
+	bis := load.Instances([]string{"./xlsform"}, &load.Config{Dir: "../../schema"})
+	if bis[0].Err != nil {
+		t.Fatal(bis[0].Err)
+	}
+	schema := cuecontext.New().BuildInstance(bis[0])
+	if schema.Err() != nil {
+		t.Fatal(schema.Err())
+	}
+	op, values := schema.LookupPath(cue.MakePath(cue.Def("#QuestionType"))).Expr()
+	if op != cue.OrOp {
+		t.Fatalf("have #QuestionType op %s, want a disjunction", op)
+	}
+	want := []string{}
+	for _, value := range values {
+		questionType, err := value.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, questionType)
+	}
+	have := slices.Clone(questionTypes)
+	slices.Sort(have)
+	slices.Sort(want)
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("the type dropdown has\n%v\nbut #QuestionType is\n%v", have, want)
+	}
+}
+
+func TestRequiredDropdown(t *testing.T) {
+	form := &xlsForm{
+		surveyColumnHeaders: []string{"type", "name", "required"},
+		survey: [][]string{
+			{"text", "family_name", "true()"},
+			{"integer", "age", "${family_name} != ''"},
+			{"text", "notes", "no"},
+		},
+	}
+	dropdowns := form.dropdowns([]sheet{{name: surveySheetName, headers: form.surveyColumnHeaders}})
+	idx := slices.IndexFunc(dropdowns, func(d dropdown) bool { return d.column == "required" })
+	if idx == -1 {
+		t.Fatal("missing required dropdown")
+	}
+	// the values the encoder writes don't get an unknown value warning
+	if want := []string{"yes", "no", "true()", "false()", "${family_name} != ''"}; !reflect.DeepEqual(dropdowns[idx].values, want) {
+		t.Fatalf("have required dropdown %v, want %v", dropdowns[idx].values, want)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+county: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "county"
+		choices: [
+			{
+				nairobi: "English (en)": "Nairobi"
+			},
+			{
+				mombasa: "English (en)": "Mombasa"
+				filterCategory: code: "001"
+			},
+		]
+	}
+	name: "county"
+	label: "English (en)": "County"
+}
+ward: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "ward"
+		choices: [
+			{
+				kilimani: "English (en)": "Kilimani"
+				filterCategory: county: "nairobi"
+			},
+			{
+				likoni: "English (en)": "Likoni"
+				filterCategory: county: "mombasa"
+			},
+		]
+	}
+	name:          "ward"
+	label: "English (en)": "Ward"
+	choice_filter: "county=${county}"
+}
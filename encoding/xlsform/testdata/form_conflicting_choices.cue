@@ -0,0 +1,31 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+yes_no: #Choices & {
+	list_name: "yes_no"
+	choices: [
+		{
+			yes: "English (en)": "Yes"
+		},
+		{
+			no: "English (en)": "No"
+		},
+	]
+}
+smokes: #Question & {
+	type:    "select_one"
+	name:    "smokes"
+	label: "English (en)": "Do you smoke?"
+	choices: yes_no
+}
+drinks: #Question & {
+	type:    "select_one"
+	name:    "drinks"
+	label: "English (en)": "Do you drink?"
+	choices: #Choices & {
+		list_name: "yes_no"
+		choices: [{maybe: "English (en)": "Maybe"}]
+	}
+}
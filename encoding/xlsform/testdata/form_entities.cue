@@ -0,0 +1,22 @@
+package main
+
+#Question: {...}
+#Entity: {...}
+
+species: #Question & {
+	type: "text"
+	name: "species"
+	label: "English (en)": "Tree species"
+	save_to: "species"
+}
+circumference: #Question & {
+	type: "integer"
+	name: "circumference"
+	label: "English (en)": "Circumference (cm)"
+	save_to: "circumference_cm"
+}
+form_entities: #Entity & {
+	list_name: "trees"
+	label:     "concat(${species}, ' ', ${circumference})"
+	create_if: "${circumference} > 0"
+}
@@ -0,0 +1,34 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+county: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "county"
+		choices: [
+			{
+				nairobi: "English (en)": "Nairobi"
+			},
+		]
+	}
+	name: "county"
+	label: "English (en)": "County"
+}
+ward: #Question & {
+	type: "select_one_external"
+	choices: #Choices & {
+		list_name: "ward"
+		external:  true
+		choices: [
+			{
+				kilimani: "English (en)": "Kilimani"
+				filterCategory: county: "nairobi"
+			},
+		]
+	}
+	name:          "ward"
+	label: "English (en)": "Ward"
+	choice_filter: "county=${county}"
+}
@@ -0,0 +1,37 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+tree: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "trees"
+		from_file: true
+		choices: [
+			{
+				oak: {
+					"English (en)": "Oak"
+					"French (fr)":  "Chêne"
+				}
+				filterCategory: region: "north"
+			},
+			{
+				acacia: "English (en)": "Acacia"
+				filterCategory: region: "south"
+			},
+		]
+	}
+	name: "tree"
+	label: "English (en)": "Which tree?"
+}
+shrubs: #Question & {
+	type: "select_multiple_from_file"
+	choices: #Choices & {
+		list_name: "shrubs"
+		from_file: true
+		choices: []
+	}
+	name: "shrubs"
+	label: "English (en)": "Which shrubs?"
+}
@@ -0,0 +1,33 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+
+family_name: #Question & {
+	name: "family_name"
+	label: "English (en)": "What's your family name?"
+}
+age: #Question & {
+	type: "select_one"
+	name: "age"
+	label: "English (en)": "Age"
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "father_age"
+			label: "English (en)": 40
+		},
+		#Question & {
+			type: "text"
+			name:     "father_name"
+			label: "English (en)": "Name"
+			relevant: {age: 40}
+		},
+	]
+}
@@ -0,0 +1,33 @@
+package main
+
+#Question: {...}
+#Group: {...}
+
+household: #Group & {
+	type:         "begin_repeat"
+	name:         "household"
+	label: "English (en)": "Household"
+	repeat_count: 3
+	children: [
+		#Question & {
+			type:     "integer"
+			name:     "members"
+			label: "English (en)": "Members"
+			required: true
+			default:  2
+		},
+		#Question & {
+			type:      "decimal"
+			name:      "income"
+			label: "English (en)": "Income"
+			read_only: false
+			default:   2.5
+		},
+	]
+}
+notes: #Question & {
+	type:       "text"
+	name:       "notes"
+	label: "English (en)": "Notes"
+	appearance: ["multiline", "numbers"]
+}
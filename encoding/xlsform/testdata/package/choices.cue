@@ -0,0 +1,13 @@
+package household
+
+ages: #Choices & {
+	list_name: "ages"
+	choices: [
+		{
+			over_30: "English (en)": "Over 30"
+		},
+		{
+			over_40: "English (en)": "Over 40"
+		},
+	]
+}
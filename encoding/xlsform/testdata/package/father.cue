@@ -0,0 +1,15 @@
+package household
+
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type:    "select_one"
+			choices: ages
+			name:    "age"
+			label: "English (en)": "How old is your father?"
+		},
+	]
+}
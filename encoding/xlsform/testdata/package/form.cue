@@ -0,0 +1,13 @@
+package household
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+#Settings: {...}
+
+family_name: #Question & {
+	type: "text"
+	name: "family_name"
+	label: "English (en)": "What's your family name?"
+}
+father: _
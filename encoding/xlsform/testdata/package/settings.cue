@@ -0,0 +1,9 @@
+package household
+
+form_settings: #Settings & {
+	type:             "settings"
+	form_title:       "test"
+	form_id:          "test_id"
+	version:          "1"
+	default_language: "English (en)"
+}
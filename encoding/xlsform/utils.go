@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -35,12 +36,78 @@ func GetLangFromCol(translatableColumn string) (col string, lang string, err err
 	return
 }
 
+func IsMediaColumn(column string) bool {
+	return strings.HasPrefix(column, "media::")
+}
+
+// GetMediaFromCol splits a media column like media::image::English (en) into its media type and
+// language, the language is empty for media that is the same in every language
+func GetMediaFromCol(mediaColumn string) (media string, lang string, err error) {
+	match := mediaRe.FindStringSubmatch(mediaColumn)
+	if len(match) != 3 || slices.Index(MediaTypes, match[1]) == -1 {
+		err = fmt.Errorf("%s: %w", mediaColumn, ErrInvalidMedia)
+		return
+	}
+	media = match[1]
+	lang = match[2]
+	return
+}
+
+// ValueString returns the xlsform string form of a CUE value, bools become yes/no and lists are
+// joined with spaces the way columns like appearance expect them
+func ValueString(val cue.Value) (string, error) {
+	switch val.Kind() {
+	case cue.BoolKind:
+		b, err := val.Bool()
+		if err != nil {
+			return "", err
+		}
+		if b {
+			return "yes", nil
+		}
+		return "no", nil
+	case cue.IntKind:
+		i, err := val.Int64()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case cue.FloatKind, cue.NumberKind:
+		f, err := val.Float64()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case cue.ListKind:
+		iter, err := val.List()
+		if err != nil {
+			return "", err
+		}
+		items := []string{}
+		for iter.Next() {
+			item, err := ValueString(iter.Value())
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		return strings.Join(items, " "), nil
+	default:
+		return val.String()
+	}
+}
+
 func LoadInstance(path string) ([]*build.Instance, error) {
+	config := &load.Config{ModuleRoot: ""}
 	formPaths := []string{path}
-	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "labels.cue")); err == nil {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		// a form split into a package, we load every file in it
+		config.Dir = path
+		formPaths = []string{"."}
+	} else if _, err := os.Stat(filepath.Join(filepath.Dir(path), "labels.cue")); err == nil {
 		formPaths = append(formPaths, filepath.Join(filepath.Dir(path), "labels.cue"))
 	}
-	bis := load.Instances(formPaths, &load.Config{ModuleRoot: ""})
+	bis := load.Instances(formPaths, config)
 	if bis[0].Err != nil {
 		return nil, fmt.Errorf("error during load: %s", errors.Details(bis[0].Err, nil))
 	}
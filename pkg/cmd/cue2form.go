@@ -37,7 +37,7 @@ func (cmd *cue2formCmd) runCue2Form(ctx context.Context, args []string) {
 			log.Println(err)
 			cmd.flag.Usage()
 		}
-	} else if strings.HasSuffix(file, ".xlsx") {
+	} else if info, err := os.Stat(file); strings.HasSuffix(file, ".xlsx") || strings.HasSuffix(file, ".ods") || strings.HasSuffix(file, ".xml") || (err == nil && info.IsDir()) {
 		cmd := newDecoderCmd()
 		err := cmd.runDecodeCmd(ctx, args)
 		if err != nil {
@@ -45,7 +45,7 @@ func (cmd *cue2formCmd) runCue2Form(ctx context.Context, args []string) {
 			cmd.flag.Usage()
 		}
 	} else {
-		log.Fatal("expecting xlsx or cue file")
+		log.Fatal("expecting xlsx, ods, xml or cue file or a directory of csv files")
 	}
 }
 
@@ -11,12 +11,18 @@ func ExecCueform(ctx context.Context) {
 	encoderCmd := newEncoderCmd()
 	decoderCmd := newDecoderCmd()
 	yankCmd := newYankCmd()
+	roundTripCmd := newRoundTripCmd()
+	diffCmd := newDiffCmd()
 	printUsage := func() {
 		encoderCmd.flag.Usage()
 		fmt.Println()
 		decoderCmd.flag.Usage()
 		fmt.Println()
 		yankCmd.flag.Usage()
+		fmt.Println()
+		roundTripCmd.flag.Usage()
+		fmt.Println()
+		diffCmd.flag.Usage()
 	}
 	if len(os.Args) <= 1 {
 		printUsage()
@@ -41,6 +47,18 @@ func ExecCueform(ctx context.Context) {
 			log.Println(err)
 			yankCmd.flag.Usage()
 		}
+	case "roundtrip":
+		err := roundTripCmd.runRoundTripCmd(ctx, os.Args[2:])
+		if err != nil {
+			log.Println(err)
+			roundTripCmd.flag.Usage()
+		}
+	case "diff":
+		err := diffCmd.runDiffCmd(ctx, os.Args[2:])
+		if err != nil {
+			log.Println(err)
+			diffCmd.flag.Usage()
+		}
 
 	default:
 		printUsage()
@@ -5,28 +5,44 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/freddieptf/cueform/encoding/xform"
 	"github.com/freddieptf/cueform/encoding/xlsform"
+	"github.com/freddieptf/cueform/pkg/labels"
 )
 
 type decoderCmd struct {
-	flag *flag.FlagSet
-	out  *string
-	pkg  *string
+	flag        *flag.FlagSet
+	out         *string
+	pkg         *string
+	typed       *bool
+	split       *bool
+	labels      *bool
+	defaultLang *string
 }
 
 func newDecoderCmd() *decoderCmd {
 	flagSet := flag.NewFlagSet("decoder", flag.ExitOnError)
 	outPutDir := flagSet.String("out", "", "output directory, defaults to current dir")
 	pkg := flagSet.String("pkg", "", `package that has the schema definitions`)
+	typed := flagSet.Bool("typed", false, "decode yes/no and number columns like required and repeat_count as CUE bools and numbers")
+	split := flagSet.Bool("split", false, "write a package directory with a file per top level group, choices.cue and settings.cue")
+	withLabels := flagSet.Bool("labels", false, `write the translated columns to labels.cue and refer to them as _labels."<name>/<column>" in the form`)
+	defaultLang := flagSet.String("default-lang", "", `language of the label, hint and other translatable columns that have none e.g "English (en)"`)
 	return &decoderCmd{
-		flag: flagSet,
-		out:  outPutDir,
-		pkg:  pkg,
+		flag:        flagSet,
+		out:         outPutDir,
+		pkg:         pkg,
+		typed:       typed,
+		split:       split,
+		labels:      withLabels,
+		defaultLang: defaultLang,
 	}
 }
 
@@ -35,28 +51,108 @@ func (cmd *decoderCmd) runDecodeCmd(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
-	file := cmd.flag.Arg(0)
-	fReader, err := os.Open(file)
+	file := filepath.Clean(cmd.flag.Arg(0))
+	info, err := os.Stat(file)
 	if err != nil {
 		log.Fatal(err)
 	}
 	if *cmd.pkg == "" {
 		return errors.New("missing pkg")
 	}
+	var surveyBytes []byte
 	decoder := xlsform.NewDecoder(*cmd.pkg)
-	surveyBytes, err := decoder.Decode(fReader)
-	if err != nil {
+	decoder.UseTypedValues(*cmd.typed)
+	decoder.UseDefaultLang(*cmd.defaultLang)
+	if info.IsDir() {
+		surveyBytes, err = decoder.DecodeDir(file)
+	} else {
+		fReader, openErr := os.Open(file)
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+		defer fReader.Close()
+		decoder.UseAttachmentDir(filepath.Dir(file))
+		switch filepath.Ext(file) {
+		case ".xml":
+			xformDecoder := xform.NewDecoder(*cmd.pkg)
+			xformDecoder.UseAttachmentDir(filepath.Dir(file))
+			xformDecoder.UseTypedValues(*cmd.typed)
+			surveyBytes, err = xformDecoder.Decode(fReader)
+		case ".ods":
+			surveyBytes, err = decoder.DecodeODS(fReader)
+		default:
+			surveyBytes, err = decoder.Decode(fReader)
+		}
+	}
+	var decodeErrs xlsform.DecodeErrors
+	if errors.As(err, &decodeErrs) {
+		// print every problem on its own line the way a compiler would
+		for _, decodeErr := range decodeErrs {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, decodeErr)
+		}
+		os.Exit(1)
+	} else if err != nil {
 		log.Fatal(err)
 	}
+	var labelBytes []byte
+	if *cmd.labels {
+		result, err := labels.ExtractLabelsFromSource(surveyBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		surveyBytes, labelBytes = result.Form, result.Labels
+	}
+	if *cmd.split {
+		return cmd.writePackage(file, surveyBytes, labelBytes)
+	}
 	if *cmd.out == "stdout" {
+		if labelBytes != nil {
+			fmt.Printf("%s\n", labelBytes)
+		}
 		fmt.Printf("%s\n", surveyBytes)
 	} else {
-		fileName := strings.TrimSuffix(filepath.Base(file), ".xlsx")
+		fileName := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
 		if outputPath, err := writeFile(*cmd.out, fmt.Sprintf("%s.cue", fileName), surveyBytes); err != nil {
 			log.Fatalf("err writing %s: %s", fileName, err)
 		} else {
 			fmt.Println(outputPath)
 		}
+		if labelBytes != nil {
+			// the encoder picks up the labels.cue next to a form
+			if outputPath, err := writeFile(*cmd.out, "labels.cue", labelBytes); err != nil {
+				log.Fatalf("err writing %s: %s", outputPath, err)
+			} else {
+				fmt.Println(outputPath)
+			}
+		}
+	}
+	return nil
+}
+
+// writePackage splits the decoded form into a package in a directory named after file
+func (cmd *decoderCmd) writePackage(file string, surveyBytes, labelBytes []byte) error {
+	files, err := xlsform.SplitPackage(surveyBytes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if labelBytes != nil {
+		files["labels.cue"] = labelBytes
+	}
+	dir := filepath.Join(*cmd.out, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+	if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
+		log.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if outputPath, err := writeFile(dir, name, files[name]); err != nil {
+			log.Printf("err writing %s: %s", outputPath, err)
+		} else {
+			fmt.Println(outputPath)
+		}
 	}
 	return nil
 }
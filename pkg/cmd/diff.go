@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/freddieptf/cueform/encoding/xlsform"
+	"github.com/freddieptf/cueform/pkg/diff"
+)
+
+type diffCmd struct {
+	flag   *flag.FlagSet
+	pkg    *string
+	asJSON *bool
+}
+
+func newDiffCmd() *diffCmd {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	pkg := flagSet.String("pkg", "", `package that has the schema definitions, needed to compare xlsx forms and it has to resolve from the current dir`)
+	asJSON := flagSet.Bool("json", false, "print the changes as JSON")
+	return &diffCmd{
+		flag:   flagSet,
+		pkg:    pkg,
+		asJSON: asJSON,
+	}
+}
+
+// runDiffCmd prints the changes between two versions of a form, each a CUE or xlsx file. It exits
+// with 1 when a change breaks the submissions made with the old version
+func (cmd *diffCmd) runDiffCmd(ctx context.Context, args []string) error {
+	err := cmd.flag.Parse(args)
+	if err != nil {
+		return err
+	}
+	if cmd.flag.NArg() != 2 {
+		return errors.New("want an old and a new form")
+	}
+	oldForm, err := cmd.loadForm(cmd.flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	newForm, err := cmd.loadForm(cmd.flag.Arg(1))
+	if err != nil {
+		return err
+	}
+	d, err := diff.Forms(oldForm, newForm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *cmd.asJSON {
+		err = d.WriteJSON(os.Stdout)
+	} else {
+		err = d.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if d.Breaking() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (cmd *diffCmd) loadForm(file string) (*xlsform.CueForm, error) {
+	if filepath.Ext(file) != ".xlsx" {
+		form, err := xlsform.ParseCueForm(file)
+		if err != nil {
+			log.Fatalf("%s: %s", file, err)
+		}
+		return form, nil
+	}
+	if *cmd.pkg == "" {
+		return nil, errors.New("missing pkg")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	decoder := xlsform.NewDecoder(*cmd.pkg)
+	decoder.UseAttachmentDir(filepath.Dir(file))
+	form, err := decoder.DecodeCueForm(f)
+	if err != nil {
+		log.Fatalf("%s: %s", file, fmt.Errorf("decode: %w", err))
+	}
+	return form, nil
+}
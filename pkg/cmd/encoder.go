@@ -1,30 +1,45 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/freddieptf/cueform/encoding/jsonschema"
+	"github.com/freddieptf/cueform/encoding/paper"
+	"github.com/freddieptf/cueform/encoding/pyxform"
+	"github.com/freddieptf/cueform/encoding/xform"
 	"github.com/freddieptf/cueform/encoding/xlsform"
 )
 
 type encoderCmd struct {
-	flag *flag.FlagSet
-	out  *string
-	to   *string
+	flag        *flag.FlagSet
+	out         *string
+	to          *string
+	lang        *string
+	defaultLang *string
 }
 
 func newEncoderCmd() *encoderCmd {
 	flagSet := flag.NewFlagSet("encoder", flag.ExitOnError)
 	outPutDir := flagSet.String("out", "", "output directory")
-	to := flagSet.String("to", "xlsform", `expected output format`)
+	to := flagSet.String("to", "xlsform", `expected output format, one of xlsform, ods, xform, pyxform-json, jsonschema, csv, html, markdown`)
+	lang := flagSet.String("lang", "", "language to print labels in for html and markdown, defaults to the form's default_language")
+	defaultLang := flagSet.String("default-lang", "", "write the labels of a form that is only in this language to plain label columns, for xlsform, ods and csv")
 	return &encoderCmd{
-		flag: flagSet,
-		out:  outPutDir,
-		to:   to,
+		flag:        flagSet,
+		out:         outPutDir,
+		to:          to,
+		lang:        lang,
+		defaultLang: defaultLang,
 	}
 }
 
@@ -34,25 +49,119 @@ func (cmd *encoderCmd) runEncodeCmd(ctx context.Context, args []string) error {
 		return err
 	}
 	file := cmd.flag.Arg(0)
+	var (
+		f     *bytes.Buffer
+		files map[string][]byte
+		ext   string
+	)
 	switch *cmd.to {
 	case "xlsform":
 		encoder := xlsform.NewEncoder()
-		f, err := encoder.Encode(file)
-		if err != nil {
-			log.Fatal(err)
-		}
+		encoder.UseDefaultLang(*cmd.defaultLang)
+		f, err = encoder.Encode(file)
+		ext = "xlsx"
+	case "ods":
+		encoder := xlsform.NewEncoder()
+		encoder.UseDefaultLang(*cmd.defaultLang)
+		f, err = encoder.EncodeODS(file)
+		ext = "ods"
+	case "xform":
+		encoder := xform.NewEncoder()
+		f, err = encoder.Encode(file)
+		ext = "xml"
+	case "pyxform-json":
+		encoder := pyxform.NewEncoder()
+		f, err = encoder.Encode(file)
+		ext = "json"
+	case "jsonschema":
+		encoder := jsonschema.NewEncoder()
+		f, err = encoder.Encode(file)
+		ext = "schema.json"
+	case "html":
+		encoder := paper.NewEncoder(paper.HTML)
+		encoder.UseLang(*cmd.lang)
+		f, err = encoder.Encode(file)
+		ext = "html"
+	case "markdown":
+		encoder := paper.NewEncoder(paper.Markdown)
+		encoder.UseLang(*cmd.lang)
+		f, err = encoder.Encode(file)
+		ext = "md"
+	case "csv":
 		if *cmd.out == "stdout" {
-			fmt.Printf("%s", f.Bytes())
-		} else {
-			fileName := strings.TrimSuffix(filepath.Base(file), ".cue")
-			if outputPath, err := writeFile(*cmd.out, fmt.Sprintf("%s.xlsx", fileName), f.Bytes()); err != nil {
-				log.Printf("err writing %s: %s", outputPath, err)
-			} else {
-				fmt.Println(outputPath)
-			}
+			return errors.New("a csv bundle is several files, it needs an output directory")
 		}
+		encoder := xlsform.NewEncoder()
+		encoder.UseDefaultLang(*cmd.defaultLang)
+		files, err = encoder.EncodeCSV(file)
 	default:
 		return fmt.Errorf("output format not supported: %s", *cmd.to)
 	}
+	var encodeErrs xlsform.EncodeErrors
+	if errors.As(err, &encodeErrs) {
+		// print every problem on its own line the way a compiler would
+		for _, encodeErr := range encodeErrs {
+			fmt.Fprintln(os.Stderr, encodeErr)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	if *cmd.to == "csv" {
+		cmd.writeCSVBundle(file, files)
+	} else if *cmd.out == "stdout" {
+		fmt.Printf("%s", f.Bytes())
+	} else {
+		fileName := strings.TrimSuffix(filepath.Base(file), ".cue")
+		if outputPath, err := writeFile(*cmd.out, fmt.Sprintf("%s.%s", fileName, ext), f.Bytes()); err != nil {
+			log.Printf("err writing %s: %s", outputPath, err)
+		} else {
+			fmt.Println(outputPath)
+		}
+		if *cmd.to == "xlsform" || *cmd.to == "ods" {
+			cmd.writeAttachments(file)
+		}
+	}
 	return nil
 }
+
+// writeAttachments writes the csv files of the file backed choice lists in file next to the form
+func (cmd *encoderCmd) writeAttachments(file string) {
+	attachments, err := xlsform.NewEncoder().EncodeAttachments(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := make([]string, 0, len(attachments))
+	for name := range attachments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if outputPath, err := writeFile(*cmd.out, name, attachments[name]); err != nil {
+			log.Printf("err writing %s: %s", outputPath, err)
+		} else {
+			fmt.Println(outputPath)
+		}
+	}
+}
+
+// writeCSVBundle writes the CSV files of the sheets and attachments of file in a directory named
+// after the form
+func (cmd *encoderCmd) writeCSVBundle(file string, files map[string][]byte) {
+	dir := filepath.Join(*cmd.out, strings.TrimSuffix(filepath.Base(file), ".cue"))
+	if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
+		log.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if outputPath, err := writeFile(dir, name, files[name]); err != nil {
+			log.Printf("err writing %s: %s", outputPath, err)
+		} else {
+			fmt.Println(outputPath)
+		}
+	}
+}
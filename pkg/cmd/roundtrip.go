@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+type roundTripCmd struct {
+	flag        *flag.FlagSet
+	pkg         *string
+	typed       *bool
+	defaultLang *string
+}
+
+func newRoundTripCmd() *roundTripCmd {
+	flagSet := flag.NewFlagSet("roundtrip", flag.ExitOnError)
+	pkg := flagSet.String("pkg", "", `package that has the schema definitions, it has to resolve from the current dir`)
+	typed := flagSet.Bool("typed", false, "decode yes/no and number columns like required and repeat_count as CUE bools and numbers")
+	defaultLang := flagSet.String("default-lang", "", `language of the label, hint and other translatable columns that have none e.g "English (en)"`)
+	return &roundTripCmd{
+		flag:        flagSet,
+		pkg:         pkg,
+		typed:       typed,
+		defaultLang: defaultLang,
+	}
+}
+
+// runRoundTripCmd checks that every form it's given comes back the same after a decode and encode.
+// An xlsx form is decoded then encoded, a CUE form is encoded first. It prints the cells that
+// changed and exits with 1 if any did
+func (cmd *roundTripCmd) runRoundTripCmd(ctx context.Context, args []string) error {
+	err := cmd.flag.Parse(args)
+	if err != nil {
+		return err
+	}
+	if cmd.flag.NArg() == 0 {
+		return errors.New("missing file")
+	}
+	if *cmd.pkg == "" {
+		return errors.New("missing pkg")
+	}
+	lossy := false
+	for _, file := range cmd.flag.Args() {
+		diffs, err := cmd.roundTrip(file)
+		if err != nil {
+			log.Fatalf("%s: %s", file, err)
+		}
+		for _, diff := range diffs {
+			fmt.Printf("%s: %s\n", file, diff)
+		}
+		lossy = lossy || len(diffs) > 0
+	}
+	if lossy {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (cmd *roundTripCmd) roundTrip(file string) ([]xlsform.CellDiff, error) {
+	decoder := xlsform.NewDecoder(*cmd.pkg)
+	decoder.UseTypedValues(*cmd.typed)
+	decoder.UseDefaultLang(*cmd.defaultLang)
+	encoder := xlsform.NewEncoder()
+	encoder.UseDefaultLang(*cmd.defaultLang)
+	var workbook []byte
+	switch filepath.Ext(file) {
+	case ".xlsx":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder.UseAttachmentDir(filepath.Dir(file))
+		workbook = b
+	case ".cue":
+		b, err := encoder.Encode(file)
+		if err != nil {
+			return nil, fmt.Errorf("encode: %w", err)
+		}
+		workbook = b.Bytes()
+	default:
+		return nil, fmt.Errorf("unsupported file %s, want an xlsx or cue file", file)
+	}
+	return xlsform.RoundTrip(decoder, encoder, workbook)
+}
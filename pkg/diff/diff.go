@@ -0,0 +1,502 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+// the kinds of change
+const (
+	Added   = "added"
+	Removed = "removed"
+	Moved   = "moved"
+	Renamed = "renamed"
+	Changed = "changed"
+)
+
+// Change is a difference between two versions of a form
+type Change struct {
+	Kind string `json:"kind"`
+	// Element is the path of the survey element e.g father/age, a choice e.g choices/ages/over_30,
+	// form_settings or form_entities
+	Element string `json:"element"`
+	// Field is the column that changed e.g relevant or label::English (en)
+	Field string `json:"field,omitempty"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+	// Breaking is set when the submissions made with the old form don't fit the new one
+	Breaking bool `json:"breaking"`
+}
+
+func (c Change) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", c.Kind, c.Element)
+	if c.Field != "" {
+		fmt.Fprintf(&b, " %s", c.Field)
+	}
+	if c.Old != "" || c.New != "" {
+		fmt.Fprintf(&b, ": %q -> %q", c.Old, c.New)
+	}
+	if c.Breaking {
+		b.WriteString(" (breaking)")
+	}
+	return b.String()
+}
+
+// Diff is the changes from one version of a form to the next in the order of the new form
+type Diff struct {
+	Changes []Change
+}
+
+// Breaking reports whether any of the changes breaks existing submissions
+func (d *Diff) Breaking() bool {
+	for _, c := range d.Changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes a change per line
+func (d *Diff) WriteText(w io.Writer) error {
+	for _, c := range d.Changes {
+		if _, err := fmt.Fprintln(w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the changes as a JSON array
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d.Changes)
+}
+
+// element is a survey element with its columns flattened the way they are in the survey sheet
+type element struct {
+	name   string
+	parent string
+	kind   string
+	fields map[string]string
+}
+
+func (el *element) path() string {
+	if el.parent == "" {
+		return el.name
+	}
+	return fmt.Sprintf("%s/%s", el.parent, el.name)
+}
+
+type choice struct {
+	name   string
+	fields map[string]string
+}
+
+// flatForm is a form with its elements keyed by path and its choice lists keyed by list_name
+type flatForm struct {
+	elements map[string]*element
+	// paths of the elements with each name, the same name can be used in different groups
+	byName map[string][]string
+	// paths of the children of each group in order, top level elements are under ""
+	children map[string][]string
+	order    []string
+	lists    map[string][]choice
+	settings map[string]string
+	entities map[string]string
+}
+
+// Forms returns the semantic changes from oldForm to newForm. Elements are matched by path, one
+// that is at a new path with its old name is taken to be moved and a removed element and an added
+// one with the same parent, type and labels are taken to be renamed
+func Forms(oldForm, newForm *xlsform.CueForm) (*Diff, error) {
+	before, err := flatten(oldForm)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flatten(newForm)
+	if err != nil {
+		return nil, err
+	}
+	d := &Diff{Changes: []Change{}}
+	moves := moved(before, after)
+	renames := renamed(before, after, moves)
+	reorders := reordered(before, after)
+	for _, path := range after.order {
+		el := after.elements[path]
+		if old, ok := before.elements[path]; ok {
+			if _, ok := reorders[path]; ok {
+				d.Changes = append(d.Changes, Change{Kind: Moved, Element: path})
+			}
+			d.Changes = append(d.Changes, compareFields(path, old.fields, el.fields)...)
+		} else if oldPath, ok := moves[path]; ok {
+			// the data of the element moves to another path in the submission
+			d.Changes = append(d.Changes, Change{Kind: Moved, Element: path, Old: oldPath, New: path, Breaking: true})
+			d.Changes = append(d.Changes, compareFields(path, before.elements[oldPath].fields, el.fields)...)
+		} else if oldPath, ok := renames[path]; ok {
+			old := before.elements[oldPath]
+			d.Changes = append(d.Changes, Change{Kind: Renamed, Element: path, Old: old.name, New: el.name, Breaking: true})
+			d.Changes = append(d.Changes, compareFields(path, old.fields, el.fields)...)
+		} else {
+			d.Changes = append(d.Changes, Change{Kind: Added, Element: path})
+		}
+	}
+	matched := map[string]struct{}{}
+	for _, oldPath := range moves {
+		matched[oldPath] = struct{}{}
+	}
+	for _, oldPath := range renames {
+		matched[oldPath] = struct{}{}
+	}
+	for _, path := range before.order {
+		if _, ok := after.elements[path]; ok {
+			continue
+		}
+		if _, ok := matched[path]; !ok {
+			d.Changes = append(d.Changes, Change{Kind: Removed, Element: path, Breaking: true})
+		}
+	}
+	d.Changes = append(d.Changes, compareLists(before.lists, after.lists)...)
+	d.Changes = append(d.Changes, compareFields("form_entities", before.entities, after.entities)...)
+	d.Changes = append(d.Changes, compareFields("form_settings", before.settings, after.settings)...)
+	return d, nil
+}
+
+// compareFields returns the columns that changed, a new type or choice list breaks submissions.
+// Names are what elements are matched by so a new name is a rename
+func compareFields(path string, before, after map[string]string) []Change {
+	changes := []Change{}
+	for _, field := range fieldNames(before, after) {
+		if field != "name" && before[field] != after[field] {
+			changes = append(changes, Change{Kind: Changed, Element: path, Field: field, Old: before[field], New: after[field], Breaking: field == "type" || field == "list_name"})
+		}
+	}
+	return changes
+}
+
+// compareLists returns the lists and choices that were added, removed or changed. Submissions with
+// a value that was removed, or that is from a removed list, no longer fit
+func compareLists(before, after map[string][]choice) []Change {
+	listNames := []string{}
+	for listName := range after {
+		listNames = append(listNames, listName)
+	}
+	for listName := range before {
+		if _, ok := after[listName]; !ok {
+			listNames = append(listNames, listName)
+		}
+	}
+	sort.Strings(listNames)
+	changes := []Change{}
+	for _, listName := range listNames {
+		if _, ok := before[listName]; !ok {
+			changes = append(changes, Change{Kind: Added, Element: fmt.Sprintf("choices/%s", listName)})
+			continue
+		}
+		if _, ok := after[listName]; !ok {
+			changes = append(changes, Change{Kind: Removed, Element: fmt.Sprintf("choices/%s", listName), Breaking: true})
+			continue
+		}
+		oldChoices := map[string]choice{}
+		for _, c := range before[listName] {
+			oldChoices[c.name] = c
+		}
+		newChoices := map[string]struct{}{}
+		for _, c := range after[listName] {
+			newChoices[c.name] = struct{}{}
+			path := fmt.Sprintf("choices/%s/%s", listName, c.name)
+			if old, ok := oldChoices[c.name]; !ok {
+				changes = append(changes, Change{Kind: Added, Element: path})
+			} else {
+				changes = append(changes, compareFields(path, old.fields, c.fields)...)
+			}
+		}
+		for _, c := range before[listName] {
+			if _, ok := newChoices[c.name]; !ok {
+				changes = append(changes, Change{Kind: Removed, Element: fmt.Sprintf("choices/%s/%s", listName, c.name), Breaking: true})
+			}
+		}
+	}
+	return changes
+}
+
+// moved pairs the elements that are only at their path in after with the ones of the same
+// name that are only at their path in before. It returns the old path of each moved element
+func moved(before, after *flatForm) map[string]string {
+	moves := map[string]string{}
+	taken := map[string]struct{}{}
+	for _, path := range after.order {
+		if _, ok := before.elements[path]; ok {
+			continue
+		}
+		for _, oldPath := range before.byName[after.elements[path].name] {
+			if _, ok := after.elements[oldPath]; ok {
+				continue
+			}
+			if _, ok := taken[oldPath]; !ok {
+				moves[path] = oldPath
+				taken[oldPath] = struct{}{}
+				break
+			}
+		}
+	}
+	return moves
+}
+
+// renamed pairs the elements that are only in after with the ones that are only in before that
+// have the same parent, type and labels. It returns the old path of each renamed element
+func renamed(before, after *flatForm, moves map[string]string) map[string]string {
+	renames := map[string]string{}
+	taken := map[string]struct{}{}
+	for _, oldPath := range moves {
+		taken[oldPath] = struct{}{}
+	}
+	for _, path := range after.order {
+		if _, ok := before.elements[path]; ok {
+			continue
+		}
+		if _, ok := moves[path]; ok {
+			continue
+		}
+		el := after.elements[path]
+		for _, oldPath := range before.order {
+			old := before.elements[oldPath]
+			if _, ok := after.elements[oldPath]; ok {
+				continue
+			}
+			if _, ok := taken[oldPath]; ok {
+				continue
+			}
+			if old.parent == el.parent && old.kind == el.kind && sameLabels(old.fields, el.fields) {
+				renames[path] = oldPath
+				taken[oldPath] = struct{}{}
+				break
+			}
+		}
+	}
+	return renames
+}
+
+func sameLabels(before, after map[string]string) bool {
+	labels := 0
+	for _, field := range fieldNames(before, after) {
+		if !strings.HasPrefix(field, "label::") {
+			continue
+		}
+		if before[field] != after[field] {
+			return false
+		}
+		labels++
+	}
+	return labels > 0
+}
+
+// reordered returns the elements that moved within their group. The elements that kept their
+// parent are laid out in their old order, the longest run that is still in order did not move
+func reordered(before, after *flatForm) map[string]struct{} {
+	moved := map[string]struct{}{}
+	for parent, paths := range after.children {
+		oldIdx := map[string]int{}
+		for idx, path := range before.children[parent] {
+			oldIdx[path] = idx
+		}
+		kept := []string{}
+		for _, path := range paths {
+			if _, ok := oldIdx[path]; ok {
+				kept = append(kept, path)
+			}
+		}
+		inOrder := map[string]struct{}{}
+		for _, path := range longestIncreasing(kept, oldIdx) {
+			inOrder[path] = struct{}{}
+		}
+		for _, path := range kept {
+			if _, ok := inOrder[path]; !ok {
+				moved[path] = struct{}{}
+			}
+		}
+	}
+	return moved
+}
+
+// longestIncreasing returns the longest subsequence of names whose positions in idx increase
+func longestIncreasing(names []string, idx map[string]int) []string {
+	// tails[i] is the position in names of the smallest tail of a run of length i+1
+	tails := []int{}
+	prev := make([]int, len(names))
+	for i, name := range names {
+		j := sort.Search(len(tails), func(j int) bool { return idx[names[tails[j]]] >= idx[name] })
+		if j > 0 {
+			prev[i] = tails[j-1]
+		} else {
+			prev[i] = -1
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+	run := make([]string, len(tails))
+	if len(tails) == 0 {
+		return run
+	}
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		run[i] = names[k]
+	}
+	return run
+}
+
+func fieldNames(before, after map[string]string) []string {
+	names := []string{}
+	for field := range before {
+		names = append(names, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func flatten(form *xlsform.CueForm) (*flatForm, error) {
+	flat := &flatForm{
+		elements: map[string]*element{},
+		byName:   map[string][]string{},
+		children: map[string][]string{},
+		lists:    map[string][]choice{},
+		settings: map[string]string{},
+		entities: map[string]string{},
+	}
+	for _, val := range form.SurveyElements {
+		if err := flat.addElement("", *val); err != nil {
+			return nil, err
+		}
+	}
+	if form.Settings != nil {
+		if err := flattenFields("", *form.Settings, flat.settings); err != nil {
+			return nil, err
+		}
+		delete(flat.settings, "type")
+	}
+	if form.Entities != nil {
+		if err := flattenFields("", *form.Entities, flat.entities); err != nil {
+			return nil, err
+		}
+	}
+	return flat, nil
+}
+
+func (flat *flatForm) addElement(parent string, val cue.Value) error {
+	el := &element{parent: parent, fields: map[string]string{}}
+	if err := flattenFields("", val, el.fields); err != nil {
+		return err
+	}
+	el.name, el.kind = el.fields["name"], el.fields["type"]
+	if el.name == "" {
+		return fmt.Errorf("%s: %w", val.Path(), xlsform.ErrMissingField)
+	}
+	flat.elements[el.path()] = el
+	flat.byName[el.name] = append(flat.byName[el.name], el.path())
+	flat.children[parent] = append(flat.children[parent], el.path())
+	flat.order = append(flat.order, el.path())
+	if choices := val.LookupPath(cue.ParsePath("choices")); choices.Exists() {
+		listName, err := choices.LookupPath(cue.ParsePath("list_name")).String()
+		if err != nil {
+			return err
+		}
+		el.fields["list_name"] = listName
+		if _, ok := flat.lists[listName]; !ok {
+			if flat.lists[listName], err = choiceList(choices); err != nil {
+				return err
+			}
+		}
+	}
+	if children := val.LookupPath(cue.ParsePath("children")); children.Exists() {
+		iter, err := children.List()
+		if err != nil {
+			return err
+		}
+		for iter.Next() {
+			if err := flat.addElement(el.path(), iter.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// choiceList flattens the choices of a list, each choice is a struct of its name and labels with
+// the other choice columns under filterCategory
+func choiceList(val cue.Value) ([]choice, error) {
+	choices := []choice{}
+	list := val.LookupPath(cue.ParsePath("choices"))
+	if !list.Exists() {
+		return choices, nil
+	}
+	iter, err := list.List()
+	if err != nil {
+		return nil, err
+	}
+	for iter.Next() {
+		c := choice{fields: map[string]string{}}
+		fields, err := iter.Value().Fields()
+		if err != nil {
+			return nil, err
+		}
+		for fields.Next() {
+			switch key := fields.Label(); key {
+			case "filterCategory":
+				err = flattenFields("", fields.Value(), c.fields)
+			case "media":
+				err = flattenFields("media", fields.Value(), c.fields)
+			default:
+				c.name = key
+				err = flattenFields("label", fields.Value(), c.fields)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		choices = append(choices, c)
+	}
+	return choices, nil
+}
+
+// flattenFields adds the fields of val to columns, nested structs like the languages of a label
+// or media become columns like label::English (en)
+func flattenFields(prefix string, val cue.Value, columns map[string]string) error {
+	iter, err := val.Fields()
+	if err != nil {
+		return err
+	}
+	for iter.Next() {
+		key := iter.Label()
+		if key == "children" || key == "choices" {
+			continue
+		}
+		if prefix != "" {
+			key = fmt.Sprintf("%s::%s", prefix, key)
+		}
+		if iter.Value().Kind() == cue.StructKind {
+			if err := flattenFields(key, iter.Value(), columns); err != nil {
+				return err
+			}
+			continue
+		}
+		if columns[key], err = xlsform.ValueString(iter.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/freddieptf/cueform/encoding/xlsform"
+)
+
+func TestForms(t *testing.T) {
+	testCases := []struct {
+		old, new string
+		want     []string
+	}{
+		{
+			old: "testdata/old.cue",
+			new: "testdata/new.cue",
+			want: []string{
+				"moved notes",
+				`changed family_name label::Swahili (sw): "Jina lako la ukoo ni nini?" -> "Jina la ukoo?"`,
+				`changed father/age type: "integer" -> "decimal" (breaking)`,
+				`renamed father/job: "occupation" -> "job" (breaking)`,
+				`changed father/job relevant: "${age} > 18" -> "${age} >= 18"`,
+				`moved phone: "father/phone" -> "phone" (breaking)`,
+				"added email",
+				`changed choices/yes_no/no label::English (en): "No" -> "Never"`,
+				"added choices/yes_no/sometimes",
+				"removed choices/yes_no/maybe (breaking)",
+				`changed form_settings version: "1" -> "2"`,
+			},
+		},
+		{
+			old: "testdata/lists_old.cue",
+			new: "testdata/lists_new.cue",
+			want: []string{
+				`changed drinks list_name: "yes_no" -> "frequency" (breaking)`,
+				`changed mother/age label::English (en): "How old is your mother?" -> "How old is she?"`,
+				"removed pets (breaking)",
+				"removed choices/animals (breaking)",
+				"added choices/frequency",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.new, func(t *testing.T) {
+			oldForm, err := xlsform.ParseCueForm(tc.old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newForm, err := xlsform.ParseCueForm(tc.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := Forms(oldForm, newForm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := &bytes.Buffer{}
+			if err := d.WriteText(b); err != nil {
+				t.Fatal(err)
+			}
+			if have := strings.Split(strings.TrimSpace(b.String()), "\n"); !reflect.DeepEqual(have, tc.want) {
+				t.Fatalf("have\n%s\nwant\n%s", strings.Join(have, "\n"), strings.Join(tc.want, "\n"))
+			}
+			if !d.Breaking() {
+				t.Fatal("want a breaking diff")
+			}
+
+			b.Reset()
+			if err := d.WriteJSON(b); err != nil {
+				t.Fatal(err)
+			}
+			changes := []Change{}
+			if err := json.Unmarshal(b.Bytes(), &changes); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(changes, d.Changes) {
+				t.Fatalf("have %+v, want %+v", changes, d.Changes)
+			}
+		})
+	}
+}
+
+func TestFormsSame(t *testing.T) {
+	form, err := xlsform.ParseCueForm("testdata/old.cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Forms(form, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Changes) != 0 || d.Breaking() {
+		t.Fatalf("have changes %v", d.Changes)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+
+smokes: #Question & {
+	type: "select_one"
+	name: "smokes"
+	label: "English (en)": "Do you smoke?"
+	choices: #Choices & {
+		list_name: "yes_no"
+		choices: [
+			{yes: "English (en)": "Yes"},
+			{no: "English (en)": "No"},
+		]
+	}
+}
+drinks: #Question & {
+	type: "select_one"
+	name: "drinks"
+	label: "English (en)": "Do you drink?"
+	choices: #Choices & {
+		list_name: "frequency"
+		choices: [
+			{never: "English (en)": "Never"},
+			{often: "English (en)": "Often"},
+		]
+	}
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is your father?"
+		},
+	]
+}
+mother: #Group & {
+	type: "begin_group"
+	name: "mother"
+	label: "English (en)": "Mother"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is she?"
+		},
+	]
+}
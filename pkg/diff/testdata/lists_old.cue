@@ -0,0 +1,62 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+
+smokes: #Question & {
+	type: "select_one"
+	name: "smokes"
+	label: "English (en)": "Do you smoke?"
+	choices: #Choices & {
+		list_name: "yes_no"
+		choices: [
+			{yes: "English (en)": "Yes"},
+			{no: "English (en)": "No"},
+		]
+	}
+}
+drinks: #Question & {
+	type: "select_one"
+	name: "drinks"
+	label: "English (en)": "Do you drink?"
+	choices: #Choices & {
+		list_name: "yes_no"
+	}
+}
+pets: #Question & {
+	type: "select_multiple"
+	name: "pets"
+	label: "English (en)": "Which pets do you keep?"
+	choices: #Choices & {
+		list_name: "animals"
+		choices: [
+			{cat: "English (en)": "Cat"},
+			{dog: "English (en)": "Dog"},
+		]
+	}
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is your father?"
+		},
+	]
+}
+mother: #Group & {
+	type: "begin_group"
+	name: "mother"
+	label: "English (en)": "Mother"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is your mother?"
+		},
+	]
+}
@@ -0,0 +1,66 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+#Settings: {...}
+
+notes: #Question & {
+	type: "text"
+	name: "notes"
+	label: "English (en)": "Notes"
+}
+family_name: #Question & {
+	type: "text"
+	name: "family_name"
+	label: {
+		"English (en)": "What's your family name?"
+		"Swahili (sw)": "Jina la ukoo?"
+	}
+}
+smokes: #Question & {
+	type: "select_one"
+	name: "smokes"
+	label: "English (en)": "Do you smoke?"
+	choices: #Choices & {
+		list_name: "yes_no"
+		choices: [
+			{yes: "English (en)": "Yes"},
+			{no: "English (en)": "Never"},
+			{sometimes: "English (en)": "Sometimes"},
+		]
+	}
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "decimal"
+			name: "age"
+			label: "English (en)": "How old is your father?"
+		},
+		#Question & {
+			type:     "text"
+			name:     "job"
+			label: "English (en)": "What does he do?"
+			relevant: "${age} >= 18"
+		},
+	]
+}
+phone: #Question & {
+	type: "text"
+	name: "phone"
+	label: "English (en)": "Phone number"
+}
+email: #Question & {
+	type: "text"
+	name: "email"
+	label: "English (en)": "Email"
+}
+form_settings: #Settings & {
+	type:    "settings"
+	form_id: "household"
+	version: "2"
+}
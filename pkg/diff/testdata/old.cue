@@ -0,0 +1,61 @@
+package main
+
+#Question: {...}
+#Group: {...}
+#Choices: {...}
+#Settings: {...}
+
+family_name: #Question & {
+	type: "text"
+	name: "family_name"
+	label: {
+		"English (en)": "What's your family name?"
+		"Swahili (sw)": "Jina lako la ukoo ni nini?"
+	}
+}
+smokes: #Question & {
+	type: "select_one"
+	name: "smokes"
+	label: "English (en)": "Do you smoke?"
+	choices: #Choices & {
+		list_name: "yes_no"
+		choices: [
+			{yes: "English (en)": "Yes"},
+			{no: "English (en)": "No"},
+			{maybe: "English (en)": "Maybe"},
+		]
+	}
+}
+father: #Group & {
+	type: "begin_group"
+	name: "father"
+	label: "English (en)": "Father"
+	children: [
+		#Question & {
+			type: "integer"
+			name: "age"
+			label: "English (en)": "How old is your father?"
+		},
+		#Question & {
+			type:     "text"
+			name:     "occupation"
+			label: "English (en)": "What does he do?"
+			relevant: "${age} > 18"
+		},
+		#Question & {
+			type: "text"
+			name: "phone"
+			label: "English (en)": "Phone number"
+		},
+	]
+}
+notes: #Question & {
+	type: "text"
+	name: "notes"
+	label: "English (en)": "Notes"
+}
+form_settings: #Settings & {
+	type:    "settings"
+	form_id: "household"
+	version: "1"
+}
@@ -12,6 +12,7 @@ import (
 	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/format"
 	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
 	"github.com/freddieptf/cueform/encoding/xlsform"
 )
 
@@ -62,6 +63,21 @@ func ExtractLabels(formPath string) (*Result, error) {
 	return &Result{Form: form, Labels: labels}, nil
 }
 
+// ExtractLabelsFromSource is ExtractLabels for a form that is not on disk yet e.g one we just
+// decoded. The default language is taken from the form settings if set or else it's the first
+// language the form has labels in
+func ExtractLabelsFromSource(src []byte) (*Result, error) {
+	formFile, err := parser.ParseFile("form.cue", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	form, labels, err := extractLabels(sourceDefaultLang(formFile), formFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Form: form, Labels: labels}, nil
+}
+
 func extractLabels(defaultLang string, form, labels *ast.File) (formFile []byte, labelsFile []byte, err error) {
 	if form == nil {
 		err = errors.New("did not find form file")
@@ -98,6 +114,33 @@ func getDefaultLang(formPath string) (string, error) {
 	}
 }
 
+// sourceDefaultLang finds the default language of a form without evaluating it
+func sourceDefaultLang(form *ast.File) string {
+	var defaultLang, firstLang string
+	ast.Walk(form, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if !ok {
+			return true
+		}
+		name, _, err := ast.LabelName(field.Label)
+		if err != nil {
+			return true
+		}
+		if lit, ok := field.Value.(*ast.BasicLit); ok && name == "default_language" {
+			defaultLang, _ = literal.Unquote(lit.Value)
+		} else if langs, ok := field.Value.(*ast.StructLit); ok && xlsform.IsTranslatableColumn(name) && firstLang == "" && len(langs.Elts) > 0 {
+			if lang, ok := langs.Elts[0].(*ast.Field); ok {
+				firstLang, _, _ = ast.LabelName(lang.Label)
+			}
+		}
+		return true
+	}, nil)
+	if defaultLang != "" {
+		return defaultLang
+	}
+	return firstLang
+}
+
 func getLabels(defaultLang string, form *ast.File) ([]elementLabel, error) {
 	labelExtractor := newExtractor()
 	for _, el := range form.Decls {
@@ -111,6 +154,10 @@ func getLabels(defaultLang string, form *ast.File) ([]elementLabel, error) {
 			if strings.HasPrefix(name, "#") || strings.HasPrefix(name, "_#") || strings.HasPrefix(name, "_") {
 				continue
 			}
+			// no labels in there
+			if name == "form_settings" || name == "form_entities" {
+				continue
+			}
 			err = labelExtractor.extractLabels(defaultLang, v.Value.(*ast.BinaryExpr))
 			if err != nil {
 				return nil, err
@@ -213,7 +260,7 @@ func (e *extractor) extractLabels(defaultLang string, node *ast.BinaryExpr) erro
 						if err != nil {
 							return err
 						}
-						if key == "filterCategory" {
+						if key == "filterCategory" || key == "media" {
 							continue
 						}
 						var labelStruct *ast.StructLit
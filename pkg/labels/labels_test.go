@@ -40,6 +40,24 @@ func TestBuildFiles(t *testing.T) {
 	}
 }
 
+func TestExtractLabelsFromSource(t *testing.T) {
+	// a decoded form with no settings, English is the first language it has labels in
+	data, err := txtar.ParseFile("testdata/decoded.txtar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ExtractLabelsFromSource(data.Files[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Labels) != string(data.Files[1].Data) {
+		t.Fatalf("have\n%s\nwant\n%s\n", result.Labels, data.Files[1].Data)
+	}
+	if string(result.Form) != string(data.Files[2].Data) {
+		t.Fatalf("have\n%s\nwant\n%s\n", result.Form, data.Files[2].Data)
+	}
+}
+
 func TestExtractLabels(t *testing.T) {
 	testCases := []struct {
 		file   string
@@ -93,6 +111,23 @@ func TestExtractLabels(t *testing.T) {
 				},
 			},
 		},
+		{
+			file: "testdata/media.cue",
+			result: []elementLabel{
+				{
+					id: "animal/label",
+					labels: []label{
+						{lang: "English (en)", langCode: "en", text: "Which animal is this?"},
+					},
+				},
+				{
+					id: "animals/cow",
+					labels: []label{
+						{lang: "English (en)", langCode: "en", text: "Cow"},
+					},
+				},
+			},
+		},
 	}
 	sortElements := func(els []elementLabel) {
 		sort.SliceStable(els, func(i, j int) bool {
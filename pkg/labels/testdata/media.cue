@@ -0,0 +1,21 @@
+package main
+
+#Question: {...}
+#Choices: {...}
+
+animal: #Question & {
+	type: "select_one"
+	choices: #Choices & {
+		list_name: "animals"
+		choices: [
+			{
+				cow: "English (en)": "Cow"
+				media: image: "English (en)": "cow.png"
+				filterCategory: kind: "big"
+			},
+		]
+	}
+	name: "animal"
+	label: "English (en)": "Which animal is this?"
+	media: image: "English (en)": "animals.png"
+}
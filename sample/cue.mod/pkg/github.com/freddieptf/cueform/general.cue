@@ -7,7 +7,7 @@ package cueform
 	name:           string
 	label:          #Translatable
 	constraint?:    string
-	required?:      string
+	required?:      bool | string
 	relevant?:      string
 	choices?:       #Choices
 	choice_filter?: string
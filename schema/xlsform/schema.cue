@@ -12,39 +12,64 @@ package xlsform
 	constraint?:         string
 	constraint_message?: #Translatable
 	hint?:               #Translatable
-	required?:           string
+	required?:           bool | string
 	required_message?:   #Translatable
 	relevant?:           string
 	choices?:            #Choices
 	choice_filter?:      string
-	read_only?:          string
+	read_only?:          bool | string
 	calculation?:        string
-	appearance?:         string
+	appearance?: string | [...string]
+	default?: number | string
+	media?:   #Media
+	save_to?: string
 	...
 }
 
 #GroupAppearance: "field-list" | "table-list"
 #GroupType:       "begin_group" | "begin_repeat" | "begin group" | "begin repeat"
 #Group: {
-	type:        #GroupType
-	name:        string
-	label:       #Translatable
-	relevant?:   string
-	appearance?: #GroupAppearance
+	type:          #GroupType
+	name:          string
+	label:         #Translatable
+	relevant?:     string
+	appearance?:   #GroupAppearance
+	repeat_count?: int & >=0 | string
+	read_only?:    bool | string
 	children?: [...]
 	...
 }
 
 #Choice: {
-	[string]: #Translatable
+	[!~"^(filterCategory|media)$"]: #Translatable
 	filterCategory?: [string]: string
+	media?: #Media
+}
+
+#MediaFile: #Translatable | string
+#Media: {
+	image?:       #MediaFile
+	"big-image"?: #MediaFile
+	audio?:       #MediaFile
+	video?:       #MediaFile
 }
 
 #Choices: {
-	list_name: string
+	list_name:  string
+	external?:  bool
+	from_file?: bool
 	choices: [...#Choice]
 }
 
+#Entity: {
+	list_name:  string
+	label:      string
+	entity_id?: string
+	create_if?: string
+	update_if?: string
+	...
+}
+
 #Settings: {
 	form_title:       string
 	form_id:          string